@@ -0,0 +1,209 @@
+package verifier
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	mediaTypeInTotoStatement = "application/vnd.in-toto+json"
+	mediaTypeDSSEEnvelope    = "application/vnd.dsse.envelope.v1+json"
+)
+
+// DHIAttestation is a signed attestation of a Docker Hardened Image that has
+// been verified with the DHI keyring.
+type DHIAttestation struct {
+	PredicateType string
+	// Layer is the attestation manifest layer the statement was read from.
+	Layer ocispecs.Descriptor
+	// Predicate is the predicate of the in-toto statement read from the
+	// verified attestation manifest.
+	Predicate     json.RawMessage
+	SignatureInfo *types.SignatureInfo
+}
+
+// VerifyDHIAttestations verifies all signed attestations of the DHI image
+// manifest for platform, such as SBOMs, VEX documents and provenance, and
+// returns them by predicate type. Attestations without a signature are
+// skipped, but any signature that fails to verify is an error. Predicate
+// types required with WithRequiredPredicateTypes must be among the verified
+// attestations.
+func (v *Verifier) VerifyDHIAttestations(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform, opt ...ImageVerifyOpt) (map[string][]*DHIAttestation, error) {
+	opts := &ImageVerifyOpts{}
+	for _, o := range opt {
+		o(opts)
+	}
+	return v.verifyDHIAttestations(ctx, provider, desc, platform, opts, nil)
+}
+
+// verifyDHIAttestations verifies the attestations whose predicate type is
+// accepted by want, or all of them if want is nil.
+func (v *Verifier) verifyDHIAttestations(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform, opts *ImageVerifyOpts, want func(predicateType string) bool) (map[string][]*DHIAttestation, error) {
+	chains, err := image.ResolveDHIAttestations(ctx, provider, desc, platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving DHI attestations for image %s", desc.Digest)
+	}
+
+	out := map[string][]*DHIAttestation{}
+	for _, sc := range chains {
+		if sc.SignatureManifest == nil {
+			continue
+		}
+		predicateType := sc.AttestationManifest.Annotations[image.AnnotationInTotoPredicateType]
+		if want != nil && !want(predicateType) {
+			continue
+		}
+		// each attestation manifest holds one predicate type, so the
+		// required types are checked against all of them below
+		chainOpts := *opts
+		chainOpts.PredicateTypes = nil
+		chainOpts.SLSARequired = false
+		chainOpts.slsaNotRequired = true
+		chainOpts.statementTypes = func(pt string) bool {
+			return pt == predicateType
+		}
+		vc, err := v.verifySignatureChain(ctx, sc, desc.Digest, &chainOpts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "verifying %s attestation %s", predicateType, sc.AttestationManifest.Digest)
+		}
+		found := false
+		for _, stmt := range vc.statements {
+			if stmt.PredicateType != predicateType {
+				continue
+			}
+			found = true
+			out[predicateType] = append(out[predicateType], &DHIAttestation{
+				PredicateType: predicateType,
+				Layer:         stmt.layer,
+				Predicate:     stmt.Predicate,
+				SignatureInfo: vc.SignatureInfo,
+			})
+		}
+		if !found {
+			return nil, errors.Errorf("attestation manifest %s has no %s statement", sc.AttestationManifest.Digest, predicateType)
+		}
+	}
+	for _, pt := range opts.PredicateTypes {
+		if len(out[pt]) == 0 {
+			return nil, errors.Errorf("no signed %s attestation found for image %s", pt, desc.Digest)
+		}
+	}
+	if opts.SLSARequired && len(out[slsa02.PredicateSLSAProvenance]) == 0 && len(out[slsa1.PredicateSLSAProvenance]) == 0 {
+		return nil, errors.Errorf("no signed SLSA provenance attestation found for image %s", desc.Digest)
+	}
+	return out, nil
+}
+
+// statement is an in-toto statement with the predicate left unparsed.
+type statement struct {
+	Type          string             `json:"_type"`
+	PredicateType string             `json:"predicateType"`
+	Subject       []statementSubject `json:"subject"`
+	Predicate     json.RawMessage    `json:"predicate"`
+
+	layer ocispecs.Descriptor
+}
+
+type statementSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+func (s *statement) hasSubject(dgst digest.Digest) bool {
+	for _, sub := range s.Subject {
+		if sub.Digest[dgst.Algorithm().String()] == dgst.Encoded() {
+			return true
+		}
+	}
+	return false
+}
+
+// readStatements reads the in-toto statements from the layers of the
+// attestation manifest whose predicate type is accepted by want. The layers
+// are checked against their digests in the manifest, so the statements are
+// only as trusted as the manifest is.
+func readStatements(ctx context.Context, sc *image.SignatureChain, mfst *ocispecs.Manifest, want func(predicateType string) bool) ([]*statement, error) {
+	var stmts []*statement
+	for _, l := range mfst.Layers {
+		pt, ok := l.Annotations[image.AnnotationInTotoPredicateType]
+		if !ok || !want(pt) {
+			continue
+		}
+		stmt, err := readStatement(ctx, sc, l)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// readStatement reads the in-toto statement from a layer of the attestation
+// manifest and checks that its subject is the image manifest.
+func readStatement(ctx context.Context, sc *image.SignatureChain, desc ocispecs.Descriptor) (*statement, error) {
+	stmt, err := parseStatement(ctx, sc, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading statement %s from attestation manifest %s", desc.Digest, sc.AttestationManifest.Digest)
+	}
+	if !stmt.hasSubject(sc.ImageManifest.Digest) {
+		serr := &SubjectMismatchError{
+			Attestation:   sc.AttestationManifest.Digest,
+			PredicateType: stmt.PredicateType,
+			Expected:      sc.ImageManifest.Digest,
+		}
+		for _, s := range stmt.Subject {
+			for alg, enc := range s.Digest {
+				serr.Subjects = append(serr.Subjects, digest.NewDigestFromEncoded(digest.Algorithm(alg), enc))
+			}
+		}
+		slices.Sort(serr.Subjects)
+		return nil, errors.WithStack(serr)
+	}
+	return stmt, nil
+}
+
+func parseStatement(ctx context.Context, sc *image.SignatureChain, desc ocispecs.Descriptor) (*statement, error) {
+	dt, err := image.ReadBlob(ctx, sc.Provider, desc)
+	if err != nil {
+		return nil, err
+	}
+	switch desc.MediaType {
+	case mediaTypeInTotoStatement:
+	case mediaTypeDSSEEnvelope:
+		var env struct {
+			PayloadType string `json:"payloadType"`
+			Payload     string `json:"payload"`
+		}
+		if err := json.Unmarshal(dt, &env); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling DSSE envelope")
+		}
+		if env.PayloadType != mediaTypeInTotoStatement {
+			return nil, errors.Errorf("DSSE envelope has invalid payload type %q", env.PayloadType)
+		}
+		dt, err = base64.StdEncoding.DecodeString(env.Payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding DSSE payload")
+		}
+	default:
+		return nil, errors.Errorf("invalid media type %s for in-toto statement", desc.MediaType)
+	}
+	var stmt statement
+	if err := json.Unmarshal(dt, &stmt); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling in-toto statement")
+	}
+	if stmt.PredicateType != desc.Annotations[image.AnnotationInTotoPredicateType] {
+		return nil, errors.Errorf("statement predicate type %q does not match annotation %q", stmt.PredicateType, desc.Annotations[image.AnnotationInTotoPredicateType])
+	}
+	stmt.layer = desc
+	return &stmt, nil
+}
@@ -0,0 +1,55 @@
+package verifier
+
+import (
+	"testing"
+
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/roots"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDHIAttestations(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	img := newTestDHIImage(t, key)
+	provenance := img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{})
+	img.attest(slsa1.PredicateSLSAProvenance, provenance)
+	spdx := img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{"spdxVersion": "SPDX-2.3"})
+	img.attest(PredicateTypeSPDX, spdx)
+
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	for name, tc := range map[string]struct {
+		opts    []ImageVerifyOpt
+		wantErr string
+	}{
+		"all": {},
+		"required": {
+			opts: []ImageVerifyOpt{WithRequiredPredicateTypes(slsa1.PredicateSLSAProvenance, PredicateTypeSPDX)},
+		},
+		"required-missing": {
+			opts:    []ImageVerifyOpt{WithRequiredPredicateTypes(PredicateTypeSPDX, PredicateTypeCycloneDX)},
+			wantErr: "no signed " + PredicateTypeCycloneDX + " attestation found",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			atts, err := v.VerifyDHIAttestations(t.Context(), img.store, img.index, &testPlatform, tc.opts...)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, atts, 2)
+			require.Len(t, atts[slsa1.PredicateSLSAProvenance], 1)
+			require.Equal(t, provenance.Digest, atts[slsa1.PredicateSLSAProvenance][0].Layer.Digest)
+			require.Len(t, atts[PredicateTypeSPDX], 1)
+			require.Equal(t, spdx.Digest, atts[PredicateTypeSPDX][0].Layer.Digest)
+			require.JSONEq(t, `{"spdxVersion":"SPDX-2.3"}`, string(atts[PredicateTypeSPDX][0].Predicate))
+			require.True(t, atts[PredicateTypeSPDX][0].SignatureInfo.IsDHI)
+		})
+	}
+}
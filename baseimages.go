@@ -0,0 +1,187 @@
+package verifier
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/moby/policy-helpers/buildkit"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/materials"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// DefaultBaseImageMaxDepth is how many levels of base images are verified if
+// no limit is set.
+const DefaultBaseImageMaxDepth = 3
+
+// BaseImageResolver returns the image index and a provider for a base image
+// reference that is pinned by digest.
+type BaseImageResolver func(ctx context.Context, ref reference.Canonical) (ocispecs.Descriptor, image.ReferrersProvider, error)
+
+// WithBaseImages verifies the base images listed in the verified provenance,
+// and their base images up to maxDepth levels. The results are returned as a
+// tree in SignatureInfo.BaseImages and do not fail the verification of the
+// image itself.
+func WithBaseImages(resolver BaseImageResolver, maxDepth int) ImageVerifyOpt {
+	return func(o *ImageVerifyOpts) {
+		o.BaseImageResolver = resolver
+		o.BaseImageMaxDepth = maxDepth
+	}
+}
+
+// verifyBaseImages verifies the base images from the provenance in si. path
+// holds the digests of the images from the top-level image down to si.
+func (v *Verifier) verifyBaseImages(ctx context.Context, si *types.SignatureInfo, platform *ocispecs.Platform, opts *ImageVerifyOpts, path []digest.Digest) {
+	maxDepth := opts.BaseImageMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultBaseImageMaxDepth
+	}
+	if si.Provenance == nil || len(path) > maxDepth {
+		return
+	}
+
+	// the frontend image is a material but not a base image
+	var frontend string
+	if bp, err := buildkit.Parse(si.Provenance); err == nil && bp.FrontendImage() != "" {
+		if ref, err := reference.ParseNormalizedNamed(bp.FrontendImage()); err == nil {
+			frontend = ref.Name()
+		}
+	}
+
+	// base images only need provenance for their own base images
+	baseOpts := *opts
+	baseOpts.PredicateTypes = nil
+
+	for _, m := range si.Provenance.Materials {
+		if !strings.HasPrefix(m.URI, "pkg:docker/") {
+			continue
+		}
+		bi := &types.BaseImage{URI: m.URI}
+		ref, err := materials.ParseImagePURL(m.URI)
+		if err != nil {
+			bi.Error = err.Error()
+			si.BaseImages = append(si.BaseImages, bi)
+			continue
+		}
+		if ref.Name() == frontend {
+			continue
+		}
+		si.BaseImages = append(si.BaseImages, bi)
+		bi.Image = ref.String()
+
+		enc, ok := m.Digest[digest.SHA256.String()]
+		if !ok {
+			bi.Error = "base image is not pinned by digest"
+			continue
+		}
+		dgst := digest.NewDigestFromEncoded(digest.SHA256, enc)
+		bi.Digest = dgst.String()
+		if slices.Contains(path, dgst) {
+			bi.Error = "base image cycle detected"
+			continue
+		}
+
+		pl, err := purlPlatform(m.URI)
+		if err != nil {
+			bi.Error = err.Error()
+			continue
+		}
+		if pl == nil {
+			pl = platform
+		}
+
+		child, err := v.verifyBaseImage(ctx, ref, dgst, pl, &baseOpts, path)
+		if err != nil {
+			bi.Error = err.Error()
+			continue
+		}
+		bi.SignatureInfo = child
+	}
+}
+
+func (v *Verifier) verifyBaseImage(ctx context.Context, ref reference.Named, dgst digest.Digest, platform *ocispecs.Platform, opts *ImageVerifyOpts, path []digest.Digest) (*types.SignatureInfo, error) {
+	pinned, err := reference.WithDigest(reference.TrimNamed(ref), dgst)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	desc, provider, err := opts.BaseImageResolver(ctx, pinned)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving base image %s", pinned)
+	}
+	if desc.Digest != dgst {
+		return nil, errors.Errorf("resolved base image %s has digest %s", pinned, desc.Digest)
+	}
+	sc, err := image.ResolveSignatureChain(ctx, provider, desc, platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving signature chain for image %s", desc.Digest)
+	}
+	vc, err := v.verifySignatureChain(ctx, sc, desc.Digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	si := vc.SignatureInfo
+	v.verifyBaseImages(ctx, si, platform, opts, append(slices.Clone(path), dgst))
+	return si, nil
+}
+
+// purlPlatform returns the platform qualifier of a package URL.
+func purlPlatform(purl string) (*ocispecs.Platform, error) {
+	_, query, ok := strings.Cut(purl, "?")
+	if !ok {
+		return nil, nil
+	}
+	qs, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing package URL %q", purl)
+	}
+	s := qs.Get("platform")
+	if s == "" {
+		return nil, nil
+	}
+	p, err := platforms.Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing platform of package URL %q", purl)
+	}
+	p = platforms.Normalize(p)
+	return &p, nil
+}
+
+// markWeakestLink marks the base image in the tree of si with the weakest
+// signature if it is weaker than si itself. Base images that could not be
+// verified are the weakest.
+func markWeakestLink(si *types.SignatureInfo) {
+	var weakest *types.BaseImage
+	limit := weakness(si)
+	var walk func(*types.SignatureInfo)
+	walk = func(si *types.SignatureInfo) {
+		for _, bi := range si.BaseImages {
+			if w := weakness(bi.SignatureInfo); w > limit {
+				weakest, limit = bi, w
+			}
+			if bi.SignatureInfo != nil {
+				walk(bi.SignatureInfo)
+			}
+		}
+	}
+	walk(si)
+	if weakest != nil {
+		weakest.WeakestLink = true
+	}
+}
+
+// weakness orders signatures by kind, which goes from the most to the least
+// trusted signer.
+func weakness(si *types.SignatureInfo) int {
+	if si == nil {
+		return math.MaxInt
+	}
+	return int(si.Kind)
+}
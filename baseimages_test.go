@@ -0,0 +1,216 @@
+package verifier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/reference"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/buildkit"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/roots"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// testBaseImages resolves base images from a set of test images.
+type testBaseImages struct {
+	images   map[digest.Digest]*testDHIImage
+	resolved []string
+}
+
+func (b *testBaseImages) add(img *testDHIImage) *testDHIImage {
+	b.images[img.index.Digest] = img
+	return img
+}
+
+func (b *testBaseImages) resolve(_ context.Context, ref reference.Canonical) (ocispecs.Descriptor, image.ReferrersProvider, error) {
+	b.resolved = append(b.resolved, ref.String())
+	img, ok := b.images[ref.Digest()]
+	if !ok {
+		return ocispecs.Descriptor{}, nil, errors.Errorf("image %s not found", ref)
+	}
+	return img.index, img.store, nil
+}
+
+// testMaterial returns a pinned image material for img.
+func testMaterial(img *testDHIImage) map[string]any {
+	return map[string]any{
+		"uri":    "pkg:docker/dhi/" + img.name + "@latest?platform=linux%2Famd64",
+		"digest": map[string]string{"sha256": img.index.Digest.Encoded()},
+	}
+}
+
+// attestBuild adds BuildKit provenance for a build from materials with the
+// Dockerfile frontend.
+func (img *testDHIImage) attestBuild(materials ...map[string]any) {
+	img.t.Helper()
+	frontend := map[string]any{
+		"uri":    "pkg:docker/docker/dockerfile@1?platform=linux%2Famd64",
+		"digest": map[string]string{"sha256": digest.FromString("frontend").Encoded()},
+	}
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{
+		"buildDefinition": map[string]any{
+			"buildType": buildkit.BuildType,
+			"externalParameters": map[string]any{
+				"request": map[string]any{
+					"frontend": "gateway.v0",
+					"args":     map[string]string{"source": "docker/dockerfile:1"},
+				},
+			},
+			"resolvedDependencies": append([]map[string]any{frontend}, materials...),
+		},
+		"runDetails": map[string]any{"builder": map[string]any{"id": "https://example.com/builder"}},
+	}))
+}
+
+func TestMarkWeakestLink(t *testing.T) {
+	selfSigned := &types.BaseImage{URI: "pkg:docker/example/base@1", SignatureInfo: &types.SignatureInfo{Kind: types.KindSelfSigned}}
+	unsigned := &types.BaseImage{URI: "pkg:docker/alpine@3.22", Error: "no signature found"}
+	dhi := &types.BaseImage{URI: "pkg:docker/dhi/golang@1", SignatureInfo: &types.SignatureInfo{
+		Kind:       types.KindDockerHardenedImage,
+		BaseImages: []*types.BaseImage{unsigned},
+	}}
+	si := &types.SignatureInfo{
+		Kind:       types.KindDockerGithubBuilder,
+		BaseImages: []*types.BaseImage{selfSigned, dhi},
+	}
+	markWeakestLink(si)
+	require.True(t, unsigned.WeakestLink)
+	require.False(t, selfSigned.WeakestLink)
+	require.False(t, dhi.WeakestLink)
+
+	// base images as strong as the image itself are not marked
+	base := &types.BaseImage{SignatureInfo: &types.SignatureInfo{Kind: types.KindSelfSigned}}
+	markWeakestLink(&types.SignatureInfo{Kind: types.KindSelfSigned, BaseImages: []*types.BaseImage{base}})
+	require.False(t, base.WeakestLink)
+}
+
+func TestPurlPlatform(t *testing.T) {
+	p, err := purlPlatform("pkg:docker/alpine@3.22?platform=linux%2Farm64%2Fv8")
+	require.NoError(t, err)
+	require.Equal(t, &ocispecs.Platform{OS: "linux", Architecture: "arm64"}, p)
+
+	p, err = purlPlatform("pkg:docker/alpine@3.22")
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	_, err = purlPlatform("pkg:docker/alpine@3.22?platform=invalid%2F%2F")
+	require.Error(t, err)
+}
+
+func TestVerifyBaseImages(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	verify := func(t *testing.T, b *testBaseImages, img *testDHIImage, maxDepth int) *types.SignatureInfo {
+		t.Helper()
+		si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform, WithBaseImages(b.resolve, maxDepth))
+		require.NoError(t, err)
+		return si
+	}
+
+	t.Run("chain", func(t *testing.T) {
+		b := &testBaseImages{images: map[digest.Digest]*testDHIImage{}}
+		root := b.add(newNamedTestDHIImage(t, key, "root"))
+		root.attestBuild()
+		base := b.add(newNamedTestDHIImage(t, key, "base"))
+		base.attestBuild(testMaterial(root))
+		img := newNamedTestDHIImage(t, key, "app")
+		img.attestBuild(testMaterial(base))
+
+		si := verify(t, b, img, 0)
+		// the frontend is not resolved as a base image
+		require.Equal(t, []string{
+			"docker.io/dhi/base@" + base.index.Digest.String(),
+			"docker.io/dhi/root@" + root.index.Digest.String(),
+		}, b.resolved)
+		require.Len(t, si.BaseImages, 1)
+		bi := si.BaseImages[0]
+		require.Empty(t, bi.Error)
+		require.Equal(t, "docker.io/dhi/base:latest", bi.Image)
+		require.Equal(t, base.index.Digest.String(), bi.Digest)
+		require.NotNil(t, bi.SignatureInfo)
+		require.True(t, bi.SignatureInfo.IsDHI)
+		require.Len(t, bi.SignatureInfo.BaseImages, 1)
+		rbi := bi.SignatureInfo.BaseImages[0]
+		require.Empty(t, rbi.Error)
+		require.Equal(t, root.index.Digest.String(), rbi.Digest)
+		require.NotNil(t, rbi.SignatureInfo)
+		require.Empty(t, rbi.SignatureInfo.BaseImages)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		b := &testBaseImages{images: map[digest.Digest]*testDHIImage{}}
+		root := b.add(newNamedTestDHIImage(t, key, "root"))
+		root.attestBuild()
+		base := b.add(newNamedTestDHIImage(t, key, "base"))
+		base.attestBuild(testMaterial(root))
+		img := newNamedTestDHIImage(t, key, "app")
+		img.attestBuild(testMaterial(base))
+
+		si := verify(t, b, img, 1)
+		require.Len(t, si.BaseImages, 1)
+		require.NotNil(t, si.BaseImages[0].SignatureInfo)
+		require.Empty(t, si.BaseImages[0].SignatureInfo.BaseImages)
+		require.Len(t, b.resolved, 1)
+
+		b.resolved = nil
+		si = verify(t, b, img, 2)
+		require.Len(t, si.BaseImages[0].SignatureInfo.BaseImages, 1)
+		require.NotNil(t, si.BaseImages[0].SignatureInfo.BaseImages[0].SignatureInfo)
+		require.Len(t, b.resolved, 2)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		b := &testBaseImages{images: map[digest.Digest]*testDHIImage{}}
+		img := b.add(newNamedTestDHIImage(t, key, "app"))
+		base := b.add(newNamedTestDHIImage(t, key, "base"))
+		base.attestBuild(testMaterial(img))
+		img.attestBuild(testMaterial(base))
+
+		si := verify(t, b, img, 0)
+		require.Len(t, si.BaseImages, 1)
+		require.NotNil(t, si.BaseImages[0].SignatureInfo)
+		bis := si.BaseImages[0].SignatureInfo.BaseImages
+		require.Len(t, bis, 1)
+		require.Equal(t, "base image cycle detected", bis[0].Error)
+		require.Nil(t, bis[0].SignatureInfo)
+		require.Len(t, b.resolved, 1)
+	})
+
+	t.Run("digest-mismatch", func(t *testing.T) {
+		b := &testBaseImages{images: map[digest.Digest]*testDHIImage{}}
+		other := newNamedTestDHIImage(t, key, "other")
+		other.attestBuild()
+		base := newNamedTestDHIImage(t, key, "base")
+		b.images[base.index.Digest] = other
+		img := newNamedTestDHIImage(t, key, "app")
+		img.attestBuild(testMaterial(base))
+
+		si := verify(t, b, img, 0)
+		require.Len(t, si.BaseImages, 1)
+		require.Contains(t, si.BaseImages[0].Error, "has digest "+other.index.Digest.String())
+		require.Nil(t, si.BaseImages[0].SignatureInfo)
+		require.True(t, si.BaseImages[0].WeakestLink)
+	})
+
+	t.Run("unpinned", func(t *testing.T) {
+		b := &testBaseImages{images: map[digest.Digest]*testDHIImage{}}
+		img := newNamedTestDHIImage(t, key, "app")
+		img.attestBuild(map[string]any{"uri": "pkg:docker/dhi/base@latest?platform=linux%2Famd64"})
+
+		si := verify(t, b, img, 0)
+		require.Len(t, si.BaseImages, 1)
+		require.Equal(t, "base image is not pinned by digest", si.BaseImages[0].Error)
+		require.Empty(t, b.resolved)
+	})
+}
@@ -0,0 +1,308 @@
+// Package buildkit parses the BuildKit specific fields of SLSA provenance
+// generated by BuildKit and provides checks for them.
+package buildkit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/distribution/reference"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/materials"
+	"github.com/moby/policy-helpers/types"
+	"github.com/pkg/errors"
+)
+
+// BuildType is the SLSA build type of provenance generated by BuildKit.
+const BuildType = "https://mobyproject.org/buildkit@v1"
+
+const (
+	FrontendDockerfile = "dockerfile.v0"
+	FrontendGateway    = "gateway.v0"
+)
+
+// ErrNotBuildKit is returned when parsing provenance of another build type.
+var ErrNotBuildKit = errors.New("provenance was not generated by BuildKit")
+
+// Provenance is SLSA provenance with the fields recorded by BuildKit.
+type Provenance struct {
+	*types.Provenance
+
+	Frontend string
+	Args     map[string]string
+	Secrets  []Secret
+	SSH      []SSH
+	Locals   []Local
+	// Hermetic is set by BuildKit when no build step had network access.
+	Hermetic bool
+	// Steps are the LLB steps of the build. They are only recorded in
+	// provenance generated with mode=max.
+	Steps []Step
+}
+
+type Secret struct {
+	ID       string `json:"id"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+type SSH struct {
+	ID       string   `json:"id"`
+	Paths    []string `json:"paths,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+type Local struct {
+	Name string `json:"name"`
+}
+
+type Step struct {
+	ID   string
+	Exec *ExecOp
+}
+
+// ExecOp is a RUN step. Enum values may be recorded as numbers or names
+// depending on the BuildKit version.
+type ExecOp struct {
+	Network  NetMode      `json:"network"`
+	Security SecurityMode `json:"security"`
+}
+
+type NetMode int
+
+const (
+	NetModeSandbox NetMode = 0
+	NetModeHost    NetMode = 1
+	NetModeNone    NetMode = 2
+)
+
+func (m *NetMode) UnmarshalJSON(dt []byte) error {
+	v, err := unmarshalEnum(dt, map[string]int{"UNSET": 0, "HOST": 1, "NONE": 2})
+	*m = NetMode(v)
+	return err
+}
+
+type SecurityMode int
+
+const (
+	SecurityModeSandbox  SecurityMode = 0
+	SecurityModeInsecure SecurityMode = 1
+)
+
+func (m *SecurityMode) UnmarshalJSON(dt []byte) error {
+	v, err := unmarshalEnum(dt, map[string]int{"SANDBOX": 0, "INSECURE": 1})
+	*m = SecurityMode(v)
+	return err
+}
+
+func unmarshalEnum(dt []byte, names map[string]int) (int, error) {
+	var n int
+	if err := json.Unmarshal(dt, &n); err == nil {
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(dt, &s); err != nil {
+		return 0, errors.Wrapf(err, "unmarshaling enum %s", dt)
+	}
+	v, ok := names[s]
+	if !ok {
+		return 0, errors.Errorf("unknown enum value %q", s)
+	}
+	return v, nil
+}
+
+type parameters struct {
+	Frontend string            `json:"frontend"`
+	Args     map[string]string `json:"args"`
+	Secrets  []Secret          `json:"secrets"`
+	SSH      []SSH             `json:"ssh"`
+	Locals   []Local           `json:"locals"`
+}
+
+type buildConfig struct {
+	Definition []struct {
+		ID string `json:"id"`
+		// field names differ in case between BuildKit versions, which
+		// encoding/json matches regardless
+		Op struct {
+			Op struct {
+				Exec *ExecOp `json:"exec"`
+			} `json:"op"`
+		} `json:"op"`
+	} `json:"llbDefinition"`
+}
+
+// Parse parses the BuildKit specific fields of verified provenance.
+func Parse(p *types.Provenance) (*Provenance, error) {
+	if p.BuildType != BuildType {
+		return nil, errors.Wrapf(ErrNotBuildKit, "build type %q", p.BuildType)
+	}
+	var (
+		params   parameters
+		cfg      *buildConfig
+		hermetic bool
+	)
+	switch p.PredicateType {
+	case slsa02.PredicateSLSAProvenance:
+		var pred struct {
+			Invocation struct {
+				Parameters parameters `json:"parameters"`
+			} `json:"invocation"`
+			BuildConfig *buildConfig `json:"buildConfig"`
+			Metadata    struct {
+				Hermetic bool `json:"https://mobyproject.org/buildkit@v1#hermetic"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(p.Predicate, &pred); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling BuildKit SLSA v0.2 provenance")
+		}
+		params, cfg, hermetic = pred.Invocation.Parameters, pred.BuildConfig, pred.Metadata.Hermetic
+	case slsa1.PredicateSLSAProvenance:
+		var pred struct {
+			BuildDefinition struct {
+				ExternalParameters struct {
+					Request parameters `json:"request"`
+				} `json:"externalParameters"`
+				InternalParameters struct {
+					BuildConfig *buildConfig `json:"buildConfig"`
+				} `json:"internalParameters"`
+			} `json:"buildDefinition"`
+			RunDetails struct {
+				Metadata struct {
+					Hermetic bool `json:"buildkit_hermetic"`
+				} `json:"metadata"`
+			} `json:"runDetails"`
+		}
+		if err := json.Unmarshal(p.Predicate, &pred); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling BuildKit SLSA v1 provenance")
+		}
+		params = pred.BuildDefinition.ExternalParameters.Request
+		cfg = pred.BuildDefinition.InternalParameters.BuildConfig
+		hermetic = pred.RunDetails.Metadata.Hermetic
+	default:
+		return nil, errors.Errorf("unexpected predicate type %q, expecting SLSA provenance", p.PredicateType)
+	}
+
+	bp := &Provenance{
+		Provenance: p,
+		Frontend:   params.Frontend,
+		Args:       params.Args,
+		Secrets:    params.Secrets,
+		SSH:        params.SSH,
+		Locals:     params.Locals,
+		Hermetic:   hermetic,
+	}
+	if cfg != nil {
+		for _, d := range cfg.Definition {
+			bp.Steps = append(bp.Steps, Step{ID: d.ID, Exec: d.Op.Op.Exec})
+		}
+	}
+	return bp, nil
+}
+
+// FrontendImage returns the image the frontend was loaded from. It is empty
+// for the Dockerfile frontend built into BuildKit.
+func (p *Provenance) FrontendImage() string {
+	if src := p.Args["source"]; src != "" {
+		return src
+	}
+	return p.Args["cmdline"]
+}
+
+// CheckMaterialsPinned returns an error if any material is not pinned by
+// digest, as decided by materials.Check.
+func (p *Provenance) CheckMaterialsPinned() error {
+	var unpinned []string
+	for _, res := range materials.Check(p.Provenance, materials.Config{}).Results {
+		if res.Digest == "" {
+			unpinned = append(unpinned, res.URI)
+		}
+	}
+	if len(unpinned) > 0 {
+		return errors.Errorf("materials are not pinned by digest: %s", strings.Join(unpinned, ", "))
+	}
+	return nil
+}
+
+// CheckNoNetwork returns an error if any RUN step had network access. Without
+// recorded steps the hermetic flag set by BuildKit is used.
+func (p *Provenance) CheckNoNetwork() error {
+	if len(p.Steps) == 0 {
+		if !p.Hermetic {
+			return errors.New("build is not hermetic, RUN steps may have had network access")
+		}
+		return nil
+	}
+	var steps []string
+	for _, s := range p.Steps {
+		if s.Exec != nil && s.Exec.Network != NetModeNone {
+			steps = append(steps, s.ID)
+		}
+	}
+	if len(steps) > 0 {
+		return errors.Errorf("RUN steps have network access: %s", strings.Join(steps, ", "))
+	}
+	return nil
+}
+
+// CheckFrontend returns an error unless the build used the Dockerfile
+// frontend, either built into BuildKit or loaded from an image matching one
+// of allowed. Allowed images match by repository, and also by digest if they
+// are pinned.
+func (p *Provenance) CheckFrontend(allowed ...string) error {
+	if p.Frontend != FrontendDockerfile && p.Frontend != FrontendGateway {
+		return errors.Errorf("frontend %q is not %s", p.Frontend, FrontendDockerfile)
+	}
+	src := p.FrontendImage()
+	if src == "" {
+		if p.Frontend == FrontendGateway {
+			return errors.New("gateway frontend has no source image")
+		}
+		return nil
+	}
+	ref, err := reference.ParseNormalizedNamed(src)
+	if err != nil {
+		return errors.Wrapf(err, "parsing frontend image %q", src)
+	}
+	for _, a := range allowed {
+		aref, err := reference.ParseNormalizedNamed(a)
+		if err != nil {
+			return errors.Wrapf(err, "parsing allowed frontend image %q", a)
+		}
+		if aref.Name() != ref.Name() {
+			continue
+		}
+		if ad, ok := aref.(reference.Digested); ok {
+			if d, ok := ref.(reference.Digested); !ok || d.Digest() != ad.Digest() {
+				continue
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("frontend image %q is not allowed", src)
+}
+
+// CheckNoInsecureEntitlements returns an error if any RUN step used the
+// network.host or security.insecure entitlement. The steps are only recorded
+// in provenance generated with mode=max.
+func (p *Provenance) CheckNoInsecureEntitlements() error {
+	if len(p.Steps) == 0 {
+		return errors.New("provenance has no build steps, mode=max is required")
+	}
+	var steps []string
+	for _, s := range p.Steps {
+		if s.Exec == nil {
+			continue
+		}
+		if s.Exec.Network == NetModeHost {
+			steps = append(steps, s.ID+" (network.host)")
+		}
+		if s.Exec.Security == SecurityModeInsecure {
+			steps = append(steps, s.ID+" (security.insecure)")
+		}
+	}
+	if len(steps) > 0 {
+		return errors.Errorf("RUN steps use insecure entitlements: %s", strings.Join(steps, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package buildkit
+
+import (
+	"testing"
+
+	"github.com/moby/policy-helpers/types"
+	"github.com/stretchr/testify/require"
+)
+
+const provenanceV02 = `{
+	"builder": {"id": ""},
+	"buildType": "https://mobyproject.org/buildkit@v1",
+	"materials": [
+		{"uri": "pkg:docker/docker/dockerfile@1.17", "digest": {"sha256": "38387523653efa0039f8e1c89bb74a30504e76ee9f565e25c9a09841f9427b05"}},
+		{"uri": "pkg:docker/alpine@3.22?platform=linux%2Famd64", "digest": {"sha256": "4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"}},
+		{"uri": "https://example.com/archive.tar.gz"}
+	],
+	"invocation": {
+		"configSource": {"entryPoint": "Dockerfile"},
+		"parameters": {
+			"frontend": "gateway.v0",
+			"args": {"cmdline": "docker/dockerfile:1.17", "source": "docker/dockerfile:1.17", "build-arg:VERSION": "1.0"},
+			"secrets": [{"id": "token", "optional": true}],
+			"ssh": [{"id": "default"}],
+			"locals": [{"name": "context"}, {"name": "dockerfile"}]
+		}
+	},
+	"buildConfig": {
+		"llbDefinition": [
+			{"id": "step0", "op": {"Op": {"source": {"identifier": "docker-image://docker.io/library/alpine:3.22"}}}},
+			{"id": "step1", "op": {"Op": {"exec": {"meta": {"args": ["/bin/sh", "-c", "apk add curl"]}, "network": 1, "security": 1}}}},
+			{"id": "step2", "op": {"Op": {"exec": {"meta": {"args": ["/bin/sh", "-c", "make"]}, "network": 2}}}}
+		]
+	},
+	"metadata": {"https://mobyproject.org/buildkit@v1#hermetic": false}
+}`
+
+const provenanceV1 = `{
+	"buildDefinition": {
+		"buildType": "https://mobyproject.org/buildkit@v1",
+		"externalParameters": {
+			"configSource": {"path": "Dockerfile"},
+			"request": {"frontend": "dockerfile.v0", "args": {"build-arg:VERSION": "1.0"}}
+		},
+		"internalParameters": {
+			"buildConfig": {
+				"llbDefinition": [
+					{"id": "step0", "op": {"Op": {"Exec": {"network": "NONE"}}}}
+				]
+			}
+		},
+		"resolvedDependencies": [
+			{"uri": "pkg:docker/alpine@3.22?platform=linux%2Famd64", "digest": {"sha256": "4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"}}
+		]
+	},
+	"runDetails": {
+		"builder": {"id": ""},
+		"metadata": {"buildkit_hermetic": true}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	p, err := types.ParseProvenance("https://slsa.dev/provenance/v0.2", []byte(provenanceV02))
+	require.NoError(t, err)
+	bp, err := Parse(p)
+	require.NoError(t, err)
+
+	require.Equal(t, FrontendGateway, bp.Frontend)
+	require.Equal(t, "docker/dockerfile:1.17", bp.FrontendImage())
+	require.Equal(t, "1.0", bp.Args["build-arg:VERSION"])
+	require.Equal(t, []Secret{{ID: "token", Optional: true}}, bp.Secrets)
+	require.Equal(t, []SSH{{ID: "default"}}, bp.SSH)
+	require.Equal(t, []Local{{Name: "context"}, {Name: "dockerfile"}}, bp.Locals)
+	require.False(t, bp.Hermetic)
+	require.Len(t, bp.Steps, 3)
+	require.Nil(t, bp.Steps[0].Exec)
+	require.Equal(t, &ExecOp{Network: NetModeHost, Security: SecurityModeInsecure}, bp.Steps[1].Exec)
+
+	require.ErrorContains(t, bp.CheckMaterialsPinned(), "https://example.com/archive.tar.gz")
+	require.ErrorContains(t, bp.CheckNoNetwork(), "step1")
+	require.ErrorContains(t, bp.CheckNoInsecureEntitlements(), "step1 (network.host), step1 (security.insecure)")
+	require.NoError(t, bp.CheckFrontend("docker/dockerfile"))
+	require.NoError(t, bp.CheckFrontend("docker.io/docker/dockerfile:1"))
+	require.Error(t, bp.CheckFrontend("docker/dockerfile@sha256:38387523653efa0039f8e1c89bb74a30504e76ee9f565e25c9a09841f9427b05"))
+	require.Error(t, bp.CheckFrontend("example.com/dockerfile"))
+	require.Error(t, bp.CheckFrontend())
+
+	p, err = types.ParseProvenance("https://slsa.dev/provenance/v1", []byte(provenanceV1))
+	require.NoError(t, err)
+	bp, err = Parse(p)
+	require.NoError(t, err)
+
+	require.Equal(t, FrontendDockerfile, bp.Frontend)
+	require.Empty(t, bp.FrontendImage())
+	require.True(t, bp.Hermetic)
+	require.Equal(t, []Step{{ID: "step0", Exec: &ExecOp{Network: NetModeNone}}}, bp.Steps)
+
+	require.NoError(t, bp.CheckMaterialsPinned())
+	// an empty digest value does not pin the material
+	bp.Materials = append(bp.Materials, types.ProvenanceMaterial{URI: "https://example.com/empty.tar.gz", Digest: map[string]string{"sha256": ""}})
+	require.ErrorContains(t, bp.CheckMaterialsPinned(), "https://example.com/empty.tar.gz")
+	require.NoError(t, bp.CheckNoNetwork())
+	require.NoError(t, bp.CheckNoInsecureEntitlements())
+	require.NoError(t, bp.CheckFrontend())
+}
+
+func TestParseNotBuildKit(t *testing.T) {
+	_, err := Parse(&types.Provenance{
+		PredicateType: "https://slsa.dev/provenance/v1",
+		BuildType:     "https://actions.github.io/buildtypes/workflow/v1",
+	})
+	require.ErrorIs(t, err, ErrNotBuildKit)
+}
+
+func TestCheckNoNetworkHermetic(t *testing.T) {
+	require.NoError(t, (&Provenance{Hermetic: true}).CheckNoNetwork())
+	require.Error(t, (&Provenance{}).CheckNoNetwork())
+	require.Error(t, (&Provenance{}).CheckNoInsecureEntitlements())
+}
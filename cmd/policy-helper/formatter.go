@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"text/tabwriter"
 
 	"github.com/moby/policy-helpers/types"
@@ -21,6 +22,7 @@ func (f SignatureInfoFormatter) Format(s fmt.State, verb rune) {
 
 			if f.IsDHI {
 				fmt.Fprintln(tw, "Image Type:\tDocker Hardened Image (DHI)")
+				fmt.Fprintf(tw, "Transparency Logged:\t%t\n", f.TransparencyLog)
 			}
 
 			if f.Signer != nil {
@@ -100,6 +102,41 @@ func (f SignatureInfoFormatter) Format(s fmt.State, verb rune) {
 				fmt.Fprintln(tw)
 			}
 
+			if f.DHIKeyID != "" {
+				fmt.Fprintf(tw, "DHI Key ID:\t%s\n", f.DHIKeyID)
+				fmt.Fprintln(tw)
+			}
+
+			if p := f.Provenance; p != nil {
+				fmt.Fprintf(tw, "Provenance:\t%s\n", p.PredicateType)
+				fmt.Fprintf(tw, "Builder ID:\t%s\n", p.BuilderID)
+				fmt.Fprintf(tw, "Build Type:\t%s\n", p.BuildType)
+				fmt.Fprintf(tw, "Materials:\t%d\n", len(p.Materials))
+				a := types.AssessSLSALevel(types.SignatureInfo(f), nil)
+				fmt.Fprintf(tw, "SLSA Level:\t%s\n", a.Level)
+				for _, r := range a.Reasons {
+					fmt.Fprintf(tw, "\t%s\n", r)
+				}
+				fmt.Fprintln(tw)
+			}
+			if f.ProvenanceError != "" {
+				fmt.Fprintf(tw, "Provenance Error:\t%s\n", f.ProvenanceError)
+				fmt.Fprintln(tw)
+			}
+
+			for _, a := range f.Attestations {
+				fmt.Fprintf(tw, "Attestation:\t%s\n", a.PredicateType)
+			}
+			if len(f.Attestations) > 0 {
+				fmt.Fprintln(tw)
+			}
+
+			if len(f.BaseImages) > 0 {
+				fmt.Fprintln(tw, "--- Base Images ---")
+				printBaseImages(tw, f.BaseImages, "")
+				fmt.Fprintln(tw)
+			}
+
 			// Timestamps Section
 			if len(f.Timestamps) > 0 {
 				fmt.Fprintln(tw, "--- Timestamp Verification Results ---")
@@ -119,6 +156,14 @@ func (f SignatureInfoFormatter) Format(s fmt.State, verb rune) {
 					fmt.Fprintf(s, "Using trust root last updated at: %s\n", f.TrustRootStatus.LastUpdated.Format("2006-01-02 15:04:05 MST"))
 				}
 			}
+			if f.TrustRootStatus.ExpiresSoon && f.TrustRootStatus.Expiry != nil {
+				e := f.TrustRootStatus.Expiry
+				fmt.Fprintln(s, "Warning: Trust root metadata is expired or expires soon. Verification will fail once it expires unless it can be updated.")
+				fmt.Fprintf(s, "Root expires at: %s\n", e.Root.Format("2006-01-02 15:04:05 MST"))
+				fmt.Fprintf(s, "Timestamp expires at: %s\n", e.Timestamp.Format("2006-01-02 15:04:05 MST"))
+				fmt.Fprintf(s, "Snapshot expires at: %s\n", e.Snapshot.Format("2006-01-02 15:04:05 MST"))
+				fmt.Fprintf(s, "Targets expires at: %s\n", e.Targets.Format("2006-01-02 15:04:05 MST"))
+			}
 		} else {
 			fmt.Fprintf(s, "%s,SAN=%s",
 				f.Signer.CertificateIssuer, f.Signer.SubjectAlternativeName)
@@ -129,3 +174,25 @@ func (f SignatureInfoFormatter) Format(s fmt.State, verb rune) {
 		fmt.Fprintf(s, "%%!%c(SignatureInfoFormatter)", verb)
 	}
 }
+
+func printBaseImages(w io.Writer, bis []*types.BaseImage, indent string) {
+	for _, bi := range bis {
+		name := bi.Image
+		if name == "" {
+			name = bi.URI
+		}
+		status := ""
+		if bi.SignatureInfo != nil {
+			status = bi.SignatureInfo.Name()
+		} else {
+			status = "Error: " + bi.Error
+		}
+		if bi.WeakestLink {
+			status += "\t(weakest link)"
+		}
+		fmt.Fprintf(w, "%s%s\t%s\n", indent, name, status)
+		if bi.SignatureInfo != nil {
+			printBaseImages(w, bi.SignatureInfo.BaseImages, indent+"  ")
+		}
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/containerd/platforms"
 	"github.com/distribution/reference"
 	policy "github.com/moby/policy-helpers"
 	"github.com/moby/policy-helpers/githubapi"
+	"github.com/moby/policy-helpers/image"
 	"github.com/moby/policy-helpers/types"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -32,6 +34,14 @@ func run() error {
 	var opts struct {
 		stateDir      string
 		requireOnline bool
+		inMemory      bool
+		dhiKeyring    string
+		dhiTlog       bool
+		dhiRegistries map[string]string
+		dhiSameRepo   bool
+		predicates    []string
+		requireSLSA   bool
+		baseDepth     int
 		debug         bool
 		bundle        string
 		repo          string
@@ -40,6 +50,27 @@ func run() error {
 	}
 	flag.StringVar(&opts.stateDir, "state-dir", "", "Path to state directory")
 	flag.BoolVar(&opts.requireOnline, "require-online", false, "Require online TUF roots update")
+	flag.BoolVar(&opts.inMemory, "in-memory", false, "Keep TUF state in memory, only reading the state directory if set")
+	flag.StringVar(&opts.dhiKeyring, "dhi-keyring", "", "Path to DHI keyring file (defaults to the embedded key)")
+	flag.BoolVar(&opts.dhiTlog, "dhi-require-tlog", false, "Require DHI signatures to be transparency logged")
+	flag.Func("dhi-attestation-registry", "Registry holding DHI attestations for a registry, as source=destination (can be repeated)", func(s string) error {
+		src, dst, ok := strings.Cut(s, "=")
+		if !ok || src == "" || dst == "" {
+			return errors.Errorf("invalid registry mapping %q, expected source=destination", s)
+		}
+		if opts.dhiRegistries == nil {
+			opts.dhiRegistries = map[string]string{}
+		}
+		opts.dhiRegistries[src] = dst
+		return nil
+	})
+	flag.BoolVar(&opts.dhiSameRepo, "dhi-same-repo", false, "Fall back to the repository of the image after the -dhi-attestation-registry mapping for DHI attestations (unmapped registries always use it)")
+	flag.Func("predicate-type", "In-toto predicate type the image attestation must contain, instead of SLSA provenance unless -require-slsa is set (can be repeated)", func(s string) error {
+		opts.predicates = append(opts.predicates, s)
+		return nil
+	})
+	flag.BoolVar(&opts.requireSLSA, "require-slsa", false, "Require SLSA provenance in addition to -predicate-type")
+	flag.IntVar(&opts.baseDepth, "base-images-depth", 0, "Also verify base images from provenance up to this many levels (0 disables)")
 	flag.BoolVar(&opts.debug, "debug", false, "Enable debug logging")
 	flag.StringVar(&opts.bundle, "bundle", "", "Path to attestation bundle file (if empty, will pull from GitHub)")
 	flag.StringVar(&opts.repo, "repo", "", "GitHub repository to pull attestation from (owner/repo)")
@@ -58,16 +89,25 @@ func run() error {
 	}
 
 	cfg := policy.Config{
-		StateDir:      opts.stateDir,
-		RequireOnline: opts.requireOnline,
+		StateDir:       opts.stateDir,
+		RequireOnline:  opts.requireOnline,
+		InMemoryState:  opts.inMemory,
+		DHIKeyringPath: opts.dhiKeyring,
 	}
 	v, err := policy.NewVerifier(cfg)
 	if err != nil {
 		return err
 	}
+	defer v.Close()
 
 	ctx := context.TODO()
 
+	dhiConfig := image.DefaultDHIAttestationConfig()
+	if opts.dhiRegistries != nil {
+		dhiConfig.Registries = opts.dhiRegistries
+	}
+	dhiConfig.SameRepository = opts.dhiSameRepo
+
 	switch args[0] {
 	case "artifact":
 		args := args[1:]
@@ -91,7 +131,23 @@ func run() error {
 		if len(args) == 0 {
 			return errors.Errorf("no image reference specified")
 		}
-		dgst, siginfo, err := runImageCmd(ctx, v, args[0], opts.platform)
+		var verifyOpts []policy.ImageVerifyOpt
+		if opts.dhiTlog {
+			verifyOpts = append(verifyOpts, policy.WithDHITransparencyLogRequired())
+		}
+		if len(opts.predicates) > 0 {
+			verifyOpts = append(verifyOpts, policy.WithRequiredPredicateTypes(opts.predicates...))
+		}
+		if opts.requireSLSA {
+			verifyOpts = append(verifyOpts, policy.WithSLSARequired())
+		}
+		if opts.baseDepth > 0 {
+			resolver := func(_ context.Context, ref reference.Canonical) (ocispecs.Descriptor, image.ReferrersProvider, error) {
+				return providerFromRef(ref, dhiConfig)
+			}
+			verifyOpts = append(verifyOpts, policy.WithBaseImages(resolver, opts.baseDepth))
+		}
+		dgst, siginfo, err := runImageCmd(ctx, v, args[0], opts.platform, dhiConfig, verifyOpts...)
 		if err != nil {
 			return err
 		}
@@ -152,7 +208,7 @@ func runArtifactCmd(ctx context.Context, v *policy.Verifier, artifactPath string
 	return dgst, verified, nil
 }
 
-func runImageCmd(ctx context.Context, v *policy.Verifier, imageRef, platformStr string) (digest.Digest, *types.SignatureInfo, error) {
+func runImageCmd(ctx context.Context, v *policy.Verifier, imageRef, platformStr string, dhiConfig image.DHIAttestationConfig, verifyOpts ...policy.ImageVerifyOpt) (digest.Digest, *types.SignatureInfo, error) {
 	ref, err := reference.ParseNormalizedNamed(imageRef)
 	if err != nil {
 		return "", nil, errors.Wrapf(err, "parsing image reference %q", imageRef)
@@ -168,12 +224,12 @@ func runImageCmd(ctx context.Context, v *policy.Verifier, imageRef, platformStr
 		pl = &p
 	}
 
-	desc, provider, err := providerFromRef(ref)
+	desc, provider, err := providerFromRef(ref, dhiConfig)
 	if err != nil {
 		return "", nil, errors.Wrapf(err, "getting provider for image %q", imageRef)
 	}
 
-	verified, err := v.VerifyImage(ctx, provider, desc, pl)
+	verified, err := v.VerifyImage(ctx, provider, desc, pl, verifyOpts...)
 	if err != nil {
 		return "", nil, errors.Wrapf(err, "verifying image %q", imageRef)
 	}
@@ -18,13 +18,8 @@ import (
 	"github.com/pkg/errors"
 )
 
-const (
-	hubRegistryDomain   = "docker.io"
-	scoutRegistryDomain = "registry.scout.docker.com"
-)
-
 // providerFromRef borrowed from buildkit/contentutil to avoid dependency
-func providerFromRef(ref reference.Named) (ocispecs.Descriptor, image.ReferrersProvider, error) {
+func providerFromRef(ref reference.Named, dhiConfig image.DHIAttestationConfig) (ocispecs.Descriptor, image.ReferrersProvider, error) {
 	headers := http.Header{}
 
 	dro := docker.ResolverOptions{
@@ -58,15 +53,15 @@ func providerFromRef(ref reference.Named) (ocispecs.Descriptor, image.ReferrersP
 		return ocispecs.Descriptor{}, nil, errors.Errorf("fetcher does not support referrers")
 	}
 
-	return desc, fromFetcher(remote, fetcher, refs, ref.String(), reference.Domain(ref) == "docker.io"), nil
+	return desc, fromFetcher(remote, fetcher, refs, ref.String(), dhiConfig.Repositories(ref)), nil
 }
 
-func fromFetcher(remote remotes.Resolver, f remotes.Fetcher, refs remotes.ReferrersFetcher, refName string, allowDHI bool) image.ReferrersProvider {
+func fromFetcher(remote remotes.Resolver, f remotes.Fetcher, refs remotes.ReferrersFetcher, refName string, dhiRepos []string) image.ReferrersProvider {
 	return &fetchedProvider{
 		remote:           remote,
 		f:                f,
 		ReferrersFetcher: refs,
-		dhiAllowed:       allowDHI,
+		dhiRepos:         dhiRepos,
 		refName:          refName,
 	}
 }
@@ -77,13 +72,14 @@ type fetchedProvider struct {
 	remotes.ReferrersFetcher
 	refName string
 
-	dhiAllowed          bool
+	// dhiRepos are the references that DHI attestations are looked up in
+	dhiRepos            []string
 	dhiInitMutex        sync.Mutex
 	dhiReferrersFetcher image.ReferrersProvider
 }
 
 func (p *fetchedProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
-	if p.dhiAllowed && image.IsDHI(ctx) {
+	if len(p.dhiRepos) > 0 && image.IsDHI(ctx) {
 		if desc.ArtifactType != "" || desc.MediaType == image.ArtifactTypeSigstoreBundle || desc.MediaType == image.MediaTypeCosignSimpleSigning {
 			rp, err := p.dhiReferrersProvider(ctx)
 			if err != nil {
@@ -101,7 +97,7 @@ func (p *fetchedProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor
 }
 
 func (p *fetchedProvider) FetchReferrers(ctx context.Context, dgst digest.Digest, opts ...remotes.FetchReferrersOpt) ([]ocispecs.Descriptor, error) {
-	if p.dhiAllowed && image.IsDHI(ctx) {
+	if len(p.dhiRepos) > 0 && image.IsDHI(ctx) {
 		rp, err := p.dhiReferrersProvider(ctx)
 		if err != nil {
 			return nil, err
@@ -118,20 +114,24 @@ func (p *fetchedProvider) dhiReferrersProvider(ctx context.Context) (image.Refer
 	if p.dhiReferrersFetcher != nil {
 		return p.dhiReferrersFetcher, nil
 	}
-	name := p.refName
-	if repo, found := strings.CutPrefix(name, hubRegistryDomain+"/"); found {
-		name = scoutRegistryDomain + "/" + repo
-	}
 
-	fetcher, err := p.remote.Fetcher(ctx, name)
-	if err != nil {
-		return nil, err
-	}
-	refs, ok := fetcher.(remotes.ReferrersFetcher)
-	if !ok {
-		return nil, errors.Errorf("fetcher does not support referrers")
+	providers := make([]image.ReferrersProvider, 0, len(p.dhiRepos))
+	for _, name := range p.dhiRepos {
+		if name == p.refName {
+			providers = append(providers, fromFetcher(p.remote, p.f, p.ReferrersFetcher, p.refName, nil))
+			continue
+		}
+		fetcher, err := p.remote.Fetcher(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		refs, ok := fetcher.(remotes.ReferrersFetcher)
+		if !ok {
+			return nil, errors.Errorf("fetcher does not support referrers")
+		}
+		providers = append(providers, fromFetcher(p.remote, fetcher, refs, p.refName, nil))
 	}
-	p.dhiReferrersFetcher = fromFetcher(p.remote, fetcher, refs, p.refName, false)
+	p.dhiReferrersFetcher = image.NewDHIAttestationProvider(providers...)
 	return p.dhiReferrersFetcher, nil
 }
 
@@ -4,8 +4,12 @@ import (
 	"fmt"
 
 	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 )
 
+// ErrClosed is returned when a closed verifier is used.
+var ErrClosed = errors.New("verifier is closed")
+
 type NoSigChainError struct {
 	Target         digest.Digest
 	HasAttestation bool
@@ -19,3 +23,28 @@ func (e *NoSigChainError) Error() string {
 	}
 	return fmt.Sprintf("no provenance attestation found for image %s", e.Target)
 }
+
+// SubjectMismatchError is returned when an in-toto statement of a verified
+// attestation does not name the image manifest as its subject.
+type SubjectMismatchError struct {
+	Attestation   digest.Digest
+	PredicateType string
+	Expected      digest.Digest
+	Subjects      []digest.Digest
+}
+
+var _ error = &SubjectMismatchError{}
+
+func (e *SubjectMismatchError) Error() string {
+	return fmt.Sprintf("%s statement in attestation manifest %s has subjects %v, expected image manifest %s", e.PredicateType, e.Attestation, e.Subjects, e.Expected)
+}
+
+// UnverifiedChainError is returned when a VerifiedChain that was not returned
+// by a successful verification is used.
+type UnverifiedChainError struct{}
+
+var _ error = &UnverifiedChainError{}
+
+func (e *UnverifiedChainError) Error() string {
+	return "signature chain has not been verified"
+}
@@ -2,16 +2,129 @@ package image
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 
 	"github.com/containerd/containerd/v2/core/content"
 	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/distribution/reference"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 )
 
+const (
+	hubRegistryDomain   = "docker.io"
+	scoutRegistryDomain = "registry.scout.docker.com"
+)
+
+// DHIAttestationConfig configures where the signed attestations of DHI
+// images are looked up.
+type DHIAttestationConfig struct {
+	// Registries maps the domain of an image registry to the registry that
+	// holds the attestations of its DHI images under the same repository
+	// path.
+	Registries map[string]string
+	// SameRepository adds the repository of the image as a fallback after
+	// the mapped registry, e.g. for images mirrored together with their
+	// attestations. Images from registries without a mapping already have
+	// their attestations looked up in their own repository.
+	SameRepository bool
+}
+
+// DefaultDHIAttestationConfig looks up the attestations of DHI images on
+// Docker Hub in the Docker Scout registry.
+func DefaultDHIAttestationConfig() DHIAttestationConfig {
+	return DHIAttestationConfig{
+		Registries: map[string]string{
+			hubRegistryDomain: scoutRegistryDomain,
+		},
+	}
+}
+
+// Repositories returns the references to look up the attestations of ref in,
+// in order. If none are returned, the attestations are looked up in the
+// repository of ref.
+func (c DHIAttestationConfig) Repositories(ref reference.Named) []string {
+	var refs []string
+	domain := reference.Domain(ref)
+	if dst, ok := c.Registries[domain]; ok {
+		refs = append(refs, dst+strings.TrimPrefix(ref.String(), domain))
+	}
+	if c.SameRepository {
+		refs = append(refs, ref.String())
+	}
+	return refs
+}
+
+// NewDHIAttestationProvider returns a provider that looks up referrers and
+// attestation content in each of the providers in order, e.g. for the
+// repositories returned by DHIAttestationConfig.Repositories.
+func NewDHIAttestationProvider(providers ...ReferrersProvider) ReferrersProvider {
+	return &dhiAttestationProvider{providers: providers}
+}
+
+type dhiAttestationProvider struct {
+	providers []ReferrersProvider
+}
+
+func (d *dhiAttestationProvider) FetchReferrers(ctx context.Context, dgst digest.Digest, opts ...remotes.FetchReferrersOpt) ([]ocispecs.Descriptor, error) {
+	var firstErr error
+	found := false
+	for _, p := range d.providers {
+		descs, err := p.FetchReferrers(ctx, dgst, opts...)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(descs) > 0 {
+			return descs, nil
+		}
+		found = true
+	}
+	if found || firstErr == nil {
+		return nil, nil
+	}
+	return nil, firstErr
+}
+
+func (d *dhiAttestationProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	var firstErr error
+	for _, p := range d.providers {
+		ra, err := p.ReaderAt(ctx, desc)
+		if err == nil {
+			return ra, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return nil, errors.Errorf("no provider for DHI attestation %s", desc.Digest)
+	}
+	return nil, firstErr
+}
+
 type dhiKey struct{}
 
+// IsDHIImage reports whether the image index desc is a Docker Hardened Image.
+func IsDHIImage(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) (bool, error) {
+	if desc.MediaType != ocispecs.MediaTypeImageIndex {
+		return false, nil
+	}
+	dt, err := ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return false, err
+	}
+	var index ocispecs.Index
+	if err := json.Unmarshal(dt, &index); err != nil {
+		return false, errors.Wrapf(err, "unmarshaling image index")
+	}
+	return isDHIIndex(index), nil
+}
+
 func isDHIIndex(idx ocispecs.Index) bool {
 	for _, desc := range idx.Manifests {
 		if buildid, ok := desc.Annotations["com.docker.dhi.build.id"]; !ok || buildid == "" {
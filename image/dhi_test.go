@@ -0,0 +1,54 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/distribution/reference"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDHIAttestationRepositories(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  DHIAttestationConfig
+		ref  string
+		want []string
+	}{
+		{
+			name: "default-hub",
+			cfg:  DefaultDHIAttestationConfig(),
+			ref:  "dhi/golang:1.25",
+			want: []string{"registry.scout.docker.com/dhi/golang:1.25"},
+		},
+		{
+			name: "default-other-registry",
+			cfg:  DefaultDHIAttestationConfig(),
+			ref:  "harbor.example.com/dhi/golang:1.25",
+		},
+		{
+			name: "mirror-same-repo",
+			cfg:  DHIAttestationConfig{SameRepository: true},
+			ref:  "harbor.example.com/dhi/golang:1.25",
+			want: []string{"harbor.example.com/dhi/golang:1.25"},
+		},
+		{
+			name: "mapping-and-same-repo",
+			cfg: DHIAttestationConfig{
+				Registries:     map[string]string{"harbor.example.com": "attestations.example.com"},
+				SameRepository: true,
+			},
+			ref: "harbor.example.com/dhi/golang@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want: []string{
+				"attestations.example.com/dhi/golang@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"harbor.example.com/dhi/golang@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := reference.ParseNormalizedNamed(tt.ref)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, tt.cfg.Repositories(ref))
+		})
+	}
+}
@@ -26,6 +26,7 @@ const (
 	AnnotationDockerReferenceDigest = "vnd.docker.reference.digest"
 	AnnotationDockerReferenceType   = "vnd.docker.reference.type"
 	AttestationManifestType         = "attestation-manifest"
+	AnnotationInTotoPredicateType   = "in-toto.io/predicate-type"
 )
 
 const (
@@ -117,22 +118,22 @@ func (sc *SignatureChain) OCIManifest(ctx context.Context, m *Manifest) (*ocispe
 	return &manifest, nil
 }
 
-func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform) (*SignatureChain, error) {
+// resolveIndex reads the image index and returns it with the manifest for
+// platform.
+func resolveIndex(ctx context.Context, provider ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform) (*ocispecs.Index, ocispecs.Descriptor, error) {
 	if desc.MediaType != ocispecs.MediaTypeImageIndex {
-		return nil, errors.Errorf("expected image index descriptor, got %s", desc.MediaType)
+		return nil, ocispecs.Descriptor{}, errors.Errorf("expected image index descriptor, got %s", desc.MediaType)
 	}
 
 	dt, err := ReadBlob(ctx, provider, desc)
 	if err != nil {
-		return nil, err
+		return nil, ocispecs.Descriptor{}, err
 	}
 	var index ocispecs.Index
 	if err := json.Unmarshal(dt, &index); err != nil {
-		return nil, errors.Wrapf(err, "unmarshaling image index")
+		return nil, ocispecs.Descriptor{}, errors.Wrapf(err, "unmarshaling image index")
 	}
 
-	isDHI := isDHIIndex(index)
-
 	if platform == nil {
 		p := platforms.Normalize(platforms.DefaultSpec())
 		platform = &p
@@ -140,9 +141,19 @@ func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc
 
 	manifestDesc, err := resolveImageManifest(index, *platform)
 	if err != nil {
-		return nil, errors.Wrapf(err, "resolving image manifest for platform %+v", platform)
+		return nil, ocispecs.Descriptor{}, errors.Wrapf(err, "resolving image manifest for platform %+v", platform)
+	}
+	return &index, manifestDesc, nil
+}
+
+func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform) (*SignatureChain, error) {
+	index, manifestDesc, err := resolveIndex(ctx, provider, desc, platform)
+	if err != nil {
+		return nil, err
 	}
 
+	isDHI := isDHIIndex(*index)
+
 	var attestationDesc *ocispecs.Descriptor
 	if isDHI {
 		provider = &dhiReferrersProvider{ReferrersProvider: provider}
@@ -190,11 +201,66 @@ func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc
 	sh.AttestationManifest = &Manifest{
 		Descriptor: *attestationDesc,
 	}
+	if err := resolveSignatureManifest(ctx, provider, sh); err != nil {
+		return nil, err
+	}
+	return sh, nil
+}
+
+// ResolveDHIAttestations returns a signature chain for every in-toto
+// attestation of the DHI image manifest for platform, such as its SBOMs, VEX
+// documents and provenance. The predicate type of each attestation is in the
+// annotations of its AttestationManifest.
+func ResolveDHIAttestations(ctx context.Context, provider ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform) ([]*SignatureChain, error) {
+	index, manifestDesc, err := resolveIndex(ctx, provider, desc, platform)
+	if err != nil {
+		return nil, err
+	}
+	if !isDHIIndex(*index) {
+		return nil, errors.Errorf("image %s is not a Docker Hardened Image", desc.Digest)
+	}
+
+	provider = &dhiReferrersProvider{ReferrersProvider: provider}
+	refs, err := provider.FetchReferrers(ctx, manifestDesc.Digest, remotes.WithReferrerArtifactTypes(ArtifactTypeInTotoJSON))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching referrers for manifest %s", manifestDesc.Digest)
+	}
+
+	var chains []*SignatureChain
+	for _, r := range refs {
+		if r.ArtifactType != ArtifactTypeInTotoJSON || r.Annotations[AnnotationInTotoPredicateType] == "" {
+			continue
+		}
+		sc := &SignatureChain{
+			ImageManifest: &Manifest{
+				Descriptor: manifestDesc,
+			},
+			AttestationManifest: &Manifest{
+				Descriptor: r,
+			},
+			Provider: provider,
+			DHI:      true,
+		}
+		if err := resolveSignatureManifest(ctx, provider, sc); err != nil {
+			return nil, err
+		}
+		chains = append(chains, sc)
+	}
+	if len(chains) == 0 {
+		return nil, errors.Errorf("no attestation referrers found for DHI manifest %s", manifestDesc.Digest)
+	}
+	return chains, nil
+}
+
+// resolveSignatureManifest sets the signature manifest of the attestation
+// manifest in sh if it has one.
+func resolveSignatureManifest(ctx context.Context, provider ReferrersProvider, sh *SignatureChain) error {
+	attestationDesc := sh.AttestationManifest.Descriptor
 
 	// currently not setting WithReferrerArtifactTypes in here as some registries(e.g. aws) don't know how to filter two types at once.
 	allRefs, err := provider.FetchReferrers(ctx, attestationDesc.Digest)
 	if err != nil {
-		return nil, errors.Wrapf(err, "fetching referrers for attestation manifest %s", attestationDesc.Digest)
+		return errors.Wrapf(err, "fetching referrers for attestation manifest %s", attestationDesc.Digest)
 	}
 
 	refs := make([]ocispecs.Descriptor, 0, len(allRefs))
@@ -205,7 +271,7 @@ func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc
 	}
 
 	if len(refs) == 0 {
-		return sh, nil
+		return nil
 	}
 
 	// only allowing one signature manifest for now
@@ -224,7 +290,7 @@ func ResolveSignatureChain(ctx context.Context, provider ReferrersProvider, desc
 	sh.SignatureManifest = &Manifest{
 		Descriptor: refs[0],
 	}
-	return sh, nil
+	return nil
 }
 
 func ReadBlob(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]byte, error) {
@@ -233,7 +299,7 @@ func ReadBlob(ctx context.Context, provider content.Provider, desc ocispecs.Desc
 		return nil, errors.Wrapf(err, "reading blob %s", desc.Digest)
 	}
 	if desc.Digest != digest.FromBytes(dt) {
-		return nil, errors.Wrapf(err, "digest mismatch for blob %s", desc.Digest)
+		return nil, errors.Errorf("digest mismatch for blob %s", desc.Digest)
 	}
 	return dt, nil
 }
@@ -0,0 +1,20 @@
+// Package tufrepo points a trust provider at a TUF repository other than the
+// Sigstore public good instance. It is not part of the public API and is used
+// by tests to serve their own trust roots.
+package tufrepo
+
+import "io/fs"
+
+// Repository is a TUF repository.
+type Repository struct {
+	// URL is the base URL of the repository.
+	URL string
+	// Root is the initial trusted root metadata.
+	Root []byte
+	// Seed is copied into an empty cache directory. Optional.
+	Seed fs.FS
+}
+
+// SetRepository makes the trust provider created from cfg, a
+// *roots.SigstoreRootsConfig, fetch from r. It is set by the roots package.
+var SetRepository func(cfg any, r Repository)
@@ -0,0 +1,249 @@
+// Package tuftest provides an in-memory TUF repository for tests.
+package tuftest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+	"github.com/theupdateframework/go-tuf/v2/metadata/fetcher"
+)
+
+// URL is the base URL of the repository.
+const URL = "https://tuf.test"
+
+// Repo is an in-memory TUF repository that also acts as the fetcher for the
+// trust provider.
+type Repo struct {
+	t      *testing.T
+	signer signature.Signer
+
+	mu        sync.Mutex
+	rootBytes []byte
+	root      *metadata.Metadata[metadata.RootType]
+	seed      fstest.MapFS
+	targets   *metadata.Metadata[metadata.TargetsType]
+	snapshot  *metadata.Metadata[metadata.SnapshotType]
+	timestamp *metadata.Metadata[metadata.TimestampType]
+	files     map[string][]byte
+	err       error
+	requests  int
+	// gate blocks downloads until it is closed
+	gate    chan struct{}
+	waiting int
+}
+
+// NewRepo returns a repository with targets published. The initial metadata
+// and targets are also included in the seed, like with an embedded root.
+func NewRepo(t *testing.T, targets map[string][]byte) *Repo {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := signature.LoadED25519Signer(priv)
+	require.NoError(t, err)
+	key, err := metadata.KeyFromPublicKey(pub)
+	require.NoError(t, err)
+
+	expires := time.Now().UTC().Add(365 * 24 * time.Hour)
+	root := metadata.Root(expires)
+	for _, role := range []string{metadata.ROOT, metadata.TIMESTAMP, metadata.SNAPSHOT, metadata.TARGETS} {
+		require.NoError(t, root.Signed.AddKey(key, role))
+	}
+	_, err = root.Sign(signer)
+	require.NoError(t, err)
+	rootBytes, err := root.ToBytes(false)
+	require.NoError(t, err)
+
+	r := &Repo{
+		t:         t,
+		signer:    signer,
+		rootBytes: rootBytes,
+		root:      root,
+		targets:   metadata.Targets(expires),
+		snapshot:  metadata.Snapshot(expires),
+		timestamp: metadata.Timestamp(expires),
+		seed: fstest.MapFS{
+			"root.json": &fstest.MapFile{Data: rootBytes, Mode: 0o644},
+		},
+		files: map[string][]byte{
+			"1.root.json": rootBytes,
+		},
+	}
+
+	for name, dt := range targets {
+		r.SetTarget(name, dt)
+	}
+	r.Publish()
+	for name, p := range map[string]string{
+		"timestamp.json": "timestamp.json",
+		"snapshot.json":  "1.snapshot.json",
+		"targets.json":   "1.targets.json",
+	} {
+		r.seed[name] = &fstest.MapFile{Data: r.files[p], Mode: 0o644}
+	}
+	for name, dt := range targets {
+		r.seed["targets/"+name] = &fstest.MapFile{Data: dt, Mode: 0o644}
+	}
+	return r
+}
+
+// SetTarget adds or replaces a target file. It is visible to clients after
+// the next publish.
+func (r *Repo) SetTarget(name string, dt []byte) {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tf, err := metadata.TargetFile().FromBytes(name, dt, "sha256")
+	require.NoError(r.t, err)
+	r.targets.Signed.Targets[name] = tf
+	r.files["targets/"+hex.EncodeToString(tf.Hashes["sha256"])+"."+name] = dt
+}
+
+// Publish signs new versions of the targets, snapshot and timestamp metadata.
+func (r *Repo) Publish() {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.files["timestamp.json"]; ok {
+		r.targets.Signed.Version++
+		r.snapshot.Signed.Version++
+		r.timestamp.Signed.Version++
+	}
+
+	r.targets.ClearSignatures()
+	_, err := r.targets.Sign(r.signer)
+	require.NoError(r.t, err)
+	dt, err := r.targets.ToBytes(false)
+	require.NoError(r.t, err)
+	r.files[fmt.Sprintf("%d.targets.json", r.targets.Signed.Version)] = dt
+
+	r.snapshot.Signed.Meta["targets.json"] = metadata.MetaFile(r.targets.Signed.Version)
+	r.snapshot.ClearSignatures()
+	_, err = r.snapshot.Sign(r.signer)
+	require.NoError(r.t, err)
+	dt, err = r.snapshot.ToBytes(false)
+	require.NoError(r.t, err)
+	r.files[fmt.Sprintf("%d.snapshot.json", r.snapshot.Signed.Version)] = dt
+
+	r.timestamp.Signed.Meta["snapshot.json"] = metadata.MetaFile(r.snapshot.Signed.Version)
+	r.timestamp.ClearSignatures()
+	_, err = r.timestamp.Sign(r.signer)
+	require.NoError(r.t, err)
+	dt, err = r.timestamp.ToBytes(false)
+	require.NoError(r.t, err)
+	r.files["timestamp.json"] = dt
+}
+
+// RotateRoot publishes a new version of the root metadata with the same keys.
+func (r *Repo) RotateRoot() {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.root.Signed.Version++
+	r.root.ClearSignatures()
+	_, err := r.root.Sign(r.signer)
+	require.NoError(r.t, err)
+	dt, err := r.root.ToBytes(false)
+	require.NoError(r.t, err)
+	r.files[fmt.Sprintf("%d.root.json", r.root.Signed.Version)] = dt
+}
+
+// SetError makes all downloads from the repository fail with err.
+func (r *Repo) SetError(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+}
+
+// RequestCount returns the number of download requests made to the repository.
+func (r *Repo) RequestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// Block makes downloads wait until the returned function is called.
+func (r *Repo) Block() func() {
+	gate := make(chan struct{})
+	r.mu.Lock()
+	r.gate = gate
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.gate = nil
+		r.mu.Unlock()
+		close(gate)
+	}
+}
+
+// Blocked returns the number of downloads waiting on Block.
+func (r *Repo) Blocked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.waiting
+}
+
+// Root returns the initial root metadata.
+func (r *Repo) Root() []byte {
+	return r.rootBytes
+}
+
+// Seed returns the initial metadata and targets in the layout of the cache
+// directory.
+func (r *Repo) Seed() fs.FS {
+	return r.seed
+}
+
+// Expires returns the expiry time of the metadata.
+func (r *Repo) Expires() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.timestamp.Signed.Expires
+}
+
+// NewFetcher returns the repository as the fetcher for the trust provider.
+func (r *Repo) NewFetcher() (fetcher.Fetcher, error) {
+	return r, nil
+}
+
+func (r *Repo) DownloadFile(urlPath string, maxLength int64, _ time.Duration) ([]byte, error) {
+	r.mu.Lock()
+	r.requests++
+	if gate := r.gate; gate != nil {
+		r.waiting++
+		r.mu.Unlock()
+		<-gate
+		r.mu.Lock()
+		r.waiting--
+	}
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	p, ok := strings.CutPrefix(urlPath, URL+"/")
+	if !ok {
+		return nil, &metadata.ErrDownloadHTTP{StatusCode: 404, URL: urlPath}
+	}
+	dt, ok := r.files[p]
+	if !ok {
+		return nil, &metadata.ErrDownloadHTTP{StatusCode: 404, URL: urlPath}
+	}
+	if int64(len(dt)) > maxLength {
+		return nil, &metadata.ErrDownloadLengthMismatch{Msg: "file too large"}
+	}
+	return dt, nil
+}
@@ -0,0 +1,150 @@
+// Package materials checks the materials recorded in SLSA provenance, such as
+// the base images and remote contexts of a build.
+package materials
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const purlDockerPrefix = "pkg:docker/"
+
+// Config configures the checks of the materials.
+type Config struct {
+	// Registries are the registries that image materials may be pulled
+	// from. Any registry is allowed if empty.
+	Registries []string
+	// BaseImageDigests are the digests that image materials must match if
+	// set. Frontend images are materials too, so their digests need to be
+	// included.
+	BaseImageDigests []digest.Digest
+}
+
+// Result is the result of the checks for a single material.
+type Result struct {
+	URI string
+	// Image is the image reference of an image material.
+	Image    string
+	Registry string
+	Digest   digest.Digest
+	// Errors are the checks the material failed.
+	Errors []string
+}
+
+// Report is the result of the checks for all materials.
+type Report struct {
+	Results []Result
+}
+
+// Err returns an error describing the failed materials, if any.
+func (r *Report) Err() error {
+	var failed []string
+	for _, res := range r.Results {
+		if len(res.Errors) > 0 {
+			failed = append(failed, res.URI+": "+strings.Join(res.Errors, ", "))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("materials failed checks: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Check checks that every material of the provenance is pinned by digest and
+// that image materials come from allowed registries and match the allowed
+// base image digests.
+func Check(p *types.Provenance, cfg Config) *Report {
+	r := &Report{}
+	for _, m := range p.Materials {
+		res := Result{
+			URI:    m.URI,
+			Digest: materialDigest(m.Digest),
+		}
+		if res.Digest == "" {
+			res.Errors = append(res.Errors, "not pinned by digest")
+		}
+		if strings.HasPrefix(m.URI, purlDockerPrefix) {
+			ref, err := ParseImagePURL(m.URI)
+			if err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else {
+				res.Image = ref.String()
+				res.Registry = reference.Domain(ref)
+				if len(cfg.Registries) > 0 && !slices.Contains(cfg.Registries, res.Registry) {
+					res.Errors = append(res.Errors, "registry "+res.Registry+" is not allowed")
+				}
+			}
+			if len(cfg.BaseImageDigests) > 0 && res.Digest != "" && !slices.Contains(cfg.BaseImageDigests, res.Digest) {
+				res.Errors = append(res.Errors, "digest "+res.Digest.String()+" is not an allowed base image")
+			}
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// materialDigest returns the digest of a material, preferring SHA-256. Empty
+// values do not pin the material.
+func materialDigest(ds map[string]string) digest.Digest {
+	for _, alg := range []digest.Algorithm{digest.SHA256, digest.SHA512, digest.SHA384} {
+		if v := ds[alg.String()]; v != "" {
+			return digest.NewDigestFromEncoded(alg, v)
+		}
+	}
+	// other algorithms, like the sha1 of git commits, still pin the material
+	for _, alg := range slices.Sorted(maps.Keys(ds)) {
+		if v := ds[alg]; v != "" {
+			return digest.Digest(alg + ":" + v)
+		}
+	}
+	return ""
+}
+
+// ParseImagePURL parses the package URL BuildKit records for image materials,
+// such as pkg:docker/alpine@3.22?platform=linux%2Famd64, into an image
+// reference.
+func ParseImagePURL(purl string) (reference.Named, error) {
+	rest, ok := strings.CutPrefix(purl, purlDockerPrefix)
+	if !ok {
+		return nil, errors.Errorf("%q is not a docker package URL", purl)
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, query, _ := strings.Cut(rest, "?")
+	name, version, _ := strings.Cut(rest, "@")
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unescaping package URL %q", purl)
+	}
+	version, err = url.PathUnescape(version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unescaping package URL %q", purl)
+	}
+	qs, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing package URL %q", purl)
+	}
+
+	s := name
+	if version != "" {
+		if strings.Contains(version, ":") {
+			s += "@" + version
+		} else {
+			s += ":" + version
+		}
+	}
+	if dgst := qs.Get("digest"); dgst != "" && !strings.Contains(s, "@") {
+		s += "@" + dgst
+	}
+	ref, err := reference.ParseNormalizedNamed(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing image reference of package URL %q", purl)
+	}
+	return ref, nil
+}
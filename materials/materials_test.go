@@ -0,0 +1,79 @@
+package materials
+
+import (
+	"testing"
+
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	alpineDigest     = "sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+	dockerfileDigest = "sha256:38387523653efa0039f8e1c89bb74a30504e76ee9f565e25c9a09841f9427b05"
+)
+
+func TestParseImagePURL(t *testing.T) {
+	tests := []struct {
+		purl    string
+		want    string
+		wantErr bool
+	}{
+		{purl: "pkg:docker/alpine@3.22?platform=linux%2Famd64", want: "docker.io/library/alpine:3.22"},
+		{purl: "pkg:docker/docker/dockerfile@1", want: "docker.io/docker/dockerfile:1"},
+		{purl: "pkg:docker/ghcr.io/moby/buildkit@v0.23.0?digest=" + alpineDigest, want: "ghcr.io/moby/buildkit:v0.23.0@" + alpineDigest},
+		{purl: "pkg:docker/alpine@sha256%3A4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1", want: "docker.io/library/alpine@" + alpineDigest},
+		{purl: "pkg:docker/Invalid", wantErr: true},
+		{purl: "https://example.com/archive.tar.gz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.purl, func(t *testing.T) {
+			ref, err := ParseImagePURL(tt.purl)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ref.String())
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := &types.Provenance{
+		Materials: []types.ProvenanceMaterial{
+			{URI: "pkg:docker/docker/dockerfile@1", Digest: map[string]string{"sha256": digest.Digest(dockerfileDigest).Encoded()}},
+			{URI: "pkg:docker/alpine@3.22?platform=linux%2Famd64", Digest: map[string]string{"sha256": digest.Digest(alpineDigest).Encoded()}},
+			{URI: "pkg:docker/ghcr.io/moby/buildkit@v0.23.0", Digest: map[string]string{"sha256": digest.Digest(alpineDigest).Encoded()}},
+			{URI: "https://github.com/moby/buildkit.git#refs/tags/v0.23.0", Digest: map[string]string{"sha1": "6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"}},
+			{URI: "https://example.com/archive.tar.gz"},
+			{URI: "https://example.com/empty.tar.gz", Digest: map[string]string{"sha256": ""}},
+		},
+	}
+
+	r := Check(p, Config{})
+	require.Len(t, r.Results, 6)
+	require.Equal(t, Result{
+		URI:      "pkg:docker/alpine@3.22?platform=linux%2Famd64",
+		Image:    "docker.io/library/alpine:3.22",
+		Registry: "docker.io",
+		Digest:   alpineDigest,
+	}, r.Results[1])
+	require.Equal(t, digest.Digest("sha1:6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"), r.Results[3].Digest)
+	require.Equal(t, []string{"not pinned by digest"}, r.Results[4].Errors)
+	require.Equal(t, []string{"not pinned by digest"}, r.Results[5].Errors)
+	require.ErrorContains(t, r.Err(), "https://example.com/archive.tar.gz: not pinned by digest")
+
+	p.Materials = p.Materials[:4]
+	require.NoError(t, Check(p, Config{}).Err())
+
+	r = Check(p, Config{
+		Registries:       []string{"docker.io"},
+		BaseImageDigests: []digest.Digest{alpineDigest},
+	})
+	require.Equal(t, []string{"digest " + dockerfileDigest + " is not an allowed base image"}, r.Results[0].Errors)
+	require.Empty(t, r.Results[1].Errors)
+	require.Equal(t, []string{"registry ghcr.io is not allowed"}, r.Results[2].Errors)
+	require.Empty(t, r.Results[3].Errors)
+	require.Error(t, r.Err())
+}
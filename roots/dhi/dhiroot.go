@@ -6,27 +6,24 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/sigstore/sigstore-go/pkg/root"
-	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/signature"
 )
 
 //go:embed dhi.pub
 var pubkeyPEM string
 
-// This may need to be updated if key rotation occurs.
+// dhiEpoch is the start of the validity period of the embedded key.
 const dhiEpoch = 1743595200 // 2025-04-02
 
-func TrustedRoot(fulcioTrustedRoot root.TrustedMaterial) (root.TrustedMaterial, error) {
-	pubKey, err := cryptoutils.UnmarshalPEMToPublicKey([]byte(pubkeyPEM))
-	if err != nil {
-		return nil, err
-	}
-	v, err := signature.LoadVerifierWithOpts(pubKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "loading DHI public key verifier")
+// TrustedRoot returns the trusted material for verifying a DHI signature with
+// key. Transparency logs and timestamping authorities are taken from the
+// Sigstore trusted root.
+func TrustedRoot(fulcioTrustedRoot root.TrustedMaterial, key *Key) (root.TrustedMaterial, error) {
+	if key.verifier == nil {
+		return nil, errors.Errorf("DHI key %s is not part of a keyring", key.ID)
 	}
 	return &dhiTrustedMaterial{
-		dhiVerifier: &dhiVerifier{v},
+		dhiVerifier: &dhiVerifier{Verifier: key.verifier, key: key},
 		fulcio:      fulcioTrustedRoot,
 	}, nil
 }
@@ -60,8 +57,11 @@ func (d *dhiTrustedMaterial) CTLogs() map[string]*root.TransparencyLog {
 
 type dhiVerifier struct {
 	signature.Verifier
+	key *Key
 }
 
+// ValidAtTime only checks the validity period. Revoked keys are rejected
+// after the signature has been verified so that the error can say so.
 func (d *dhiVerifier) ValidAtTime(t time.Time) bool {
-	return t.Unix() >= dhiEpoch
+	return d.key.validPeriod(t)
 }
@@ -0,0 +1,160 @@
+package dhi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+var (
+	// ErrKeyRevoked is returned when a signature was made with a key that
+	// has been revoked.
+	ErrKeyRevoked = errors.New("DHI signing key has been revoked")
+	// ErrKeyNotValid is returned when a signature was made outside of the
+	// validity period of its key.
+	ErrKeyNotValid = errors.New("DHI signing key is not valid at signing time")
+)
+
+// Key is a public key that DHI images are signed with.
+type Key struct {
+	// ID identifies the key. It is matched against the key hint of a
+	// signature and defaults to the hex encoded SHA-256 of the DER encoded
+	// public key.
+	ID string `json:"keyId,omitempty"`
+	// PublicKey is the PEM encoded public key.
+	PublicKey string `json:"publicKey"`
+	// NotBefore and NotAfter limit the period that signatures made with the
+	// key are accepted for. Zero values leave the period open. Signatures
+	// without a verified timestamp are checked at the current time, so they
+	// are rejected once NotAfter has passed.
+	NotBefore time.Time `json:"notBefore,omitzero"`
+	NotAfter  time.Time `json:"notAfter,omitzero"`
+	// Revoked keys are rejected for all signatures.
+	Revoked bool `json:"revoked,omitempty"`
+
+	verifier signature.Verifier
+}
+
+// ValidAt returns an error if signatures made with the key at t are not
+// accepted.
+func (k *Key) ValidAt(t time.Time) error {
+	if k.Revoked {
+		return errors.Wrapf(ErrKeyRevoked, "key %s", k.ID)
+	}
+	if !k.validPeriod(t) {
+		return errors.Wrapf(ErrKeyNotValid, "key %s at %s", k.ID, t.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (k *Key) validPeriod(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && t.After(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+func (k *Key) load() error {
+	pubKey, err := cryptoutils.UnmarshalPEMToPublicKey([]byte(k.PublicKey))
+	if err != nil {
+		return errors.Wrap(err, "parsing DHI public key")
+	}
+	if k.ID == "" {
+		der, err := cryptoutils.MarshalPublicKeyToDER(pubKey)
+		if err != nil {
+			return errors.Wrap(err, "marshaling DHI public key")
+		}
+		sum := sha256.Sum256(der)
+		k.ID = hex.EncodeToString(sum[:])
+	}
+	v, err := signature.LoadVerifierWithOpts(pubKey)
+	if err != nil {
+		return errors.Wrapf(err, "loading DHI public key verifier for key %s", k.ID)
+	}
+	k.verifier = v
+	return nil
+}
+
+// Keyring is the set of keys that DHI images may be signed with.
+type Keyring struct {
+	Keys []*Key `json:"keys"`
+}
+
+// NewKeyring validates the keys and returns a keyring with them.
+func NewKeyring(keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{Keys: keys}
+	if err := kr.load(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// ParseKeyring parses a JSON encoded keyring. A single PEM encoded public key
+// is also accepted as a keyring with only that key.
+func ParseKeyring(dt []byte) (*Keyring, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(dt), []byte("-----BEGIN")) {
+		return NewKeyring(&Key{PublicKey: string(dt)})
+	}
+	var kr Keyring
+	if err := json.Unmarshal(dt, &kr); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling DHI keyring")
+	}
+	return NewKeyring(kr.Keys...)
+}
+
+func (kr *Keyring) load() error {
+	if len(kr.Keys) == 0 {
+		return errors.Errorf("DHI keyring has no keys")
+	}
+	ids := map[string]struct{}{}
+	for _, k := range kr.Keys {
+		if k == nil {
+			return errors.Errorf("DHI keyring has an empty key")
+		}
+		if err := k.load(); err != nil {
+			return err
+		}
+		if _, ok := ids[k.ID]; ok {
+			return errors.Errorf("DHI keyring has duplicate key %s", k.ID)
+		}
+		ids[k.ID] = struct{}{}
+	}
+	return nil
+}
+
+// Candidates returns the keys to verify a signature with. If the key hint of
+// the signature matches a key ID only that key is returned, otherwise all
+// keys need to be tried.
+func (kr *Keyring) Candidates(hint string) []*Key {
+	if hint != "" {
+		for _, k := range kr.Keys {
+			if k.ID == hint {
+				return []*Key{k}
+			}
+		}
+	}
+	return kr.Keys
+}
+
+// EmbeddedKeyring returns the keyring with the DHI key compiled into the
+// binary.
+var EmbeddedKeyring = sync.OnceValues(func() (*Keyring, error) {
+	kr, err := NewKeyring(&Key{
+		PublicKey: pubkeyPEM,
+		NotBefore: time.Unix(dhiEpoch, 0).UTC(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading embedded DHI keyring")
+	}
+	return kr, nil
+})
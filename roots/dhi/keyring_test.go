@@ -0,0 +1,94 @@
+package dhi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyring(t *testing.T) {
+	epoch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotation := epoch.AddDate(1, 0, 0)
+
+	dt, err := json.Marshal(Keyring{Keys: []*Key{
+		{ID: "old", PublicKey: newPublicKey(t), NotBefore: epoch, NotAfter: rotation},
+		{PublicKey: newPublicKey(t), NotBefore: rotation},
+		{ID: "leaked", PublicKey: newPublicKey(t), Revoked: true},
+	}})
+	require.NoError(t, err)
+
+	kr, err := ParseKeyring(dt)
+	require.NoError(t, err)
+	require.Len(t, kr.Keys, 3)
+	old, current, leaked := kr.Keys[0], kr.Keys[1], kr.Keys[2]
+	require.Len(t, current.ID, 64)
+
+	require.Equal(t, []*Key{old}, kr.Candidates("old"))
+	require.Equal(t, kr.Keys, kr.Candidates(""))
+	require.Equal(t, kr.Keys, kr.Candidates("unknown"))
+
+	require.NoError(t, old.ValidAt(epoch.AddDate(0, 6, 0)))
+	require.ErrorIs(t, old.ValidAt(epoch.Add(-time.Second)), ErrKeyNotValid)
+	require.ErrorIs(t, old.ValidAt(rotation.Add(time.Second)), ErrKeyNotValid)
+	require.ErrorIs(t, current.ValidAt(epoch), ErrKeyNotValid)
+	require.NoError(t, current.ValidAt(rotation.AddDate(5, 0, 0)))
+	require.ErrorIs(t, leaked.ValidAt(rotation), ErrKeyRevoked)
+
+	// the verifier only checks the validity period so that revoked keys can
+	// be reported after verifying the signature
+	tm, err := TrustedRoot(nil, leaked)
+	require.NoError(t, err)
+	v, err := tm.PublicKeyVerifier("")
+	require.NoError(t, err)
+	require.True(t, v.ValidAtTime(rotation))
+}
+
+func TestParseKeyringInvalid(t *testing.T) {
+	pub := newPublicKey(t)
+	for name, kr := range map[string]Keyring{
+		"empty":     {},
+		"invalid":   {Keys: []*Key{{PublicKey: "invalid"}}},
+		"duplicate": {Keys: []*Key{{PublicKey: pub}, {PublicKey: pub}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dt, err := json.Marshal(kr)
+			require.NoError(t, err)
+			_, err = ParseKeyring(dt)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseKeyringPEM(t *testing.T) {
+	kr, err := ParseKeyring([]byte(pubkeyPEM))
+	require.NoError(t, err)
+	require.Len(t, kr.Keys, 1)
+
+	embedded, err := EmbeddedKeyring()
+	require.NoError(t, err)
+	require.Equal(t, embedded.Keys[0].ID, kr.Keys[0].ID)
+	require.True(t, kr.Keys[0].NotBefore.IsZero())
+}
+
+func TestEmbeddedKeyring(t *testing.T) {
+	kr, err := EmbeddedKeyring()
+	require.NoError(t, err)
+	require.Len(t, kr.Keys, 1)
+	require.NoError(t, kr.Keys[0].ValidAt(time.Unix(dhiEpoch, 0)))
+	require.ErrorIs(t, kr.Keys[0].ValidAt(time.Unix(dhiEpoch-1, 0)), ErrKeyNotValid)
+}
+
+func newPublicKey(t *testing.T) string {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pem, err := cryptoutils.MarshalPublicKeyToPEM(priv.Public())
+	require.NoError(t, err)
+	return string(pem)
+}
@@ -0,0 +1,88 @@
+package roots
+
+import (
+	digest "github.com/opencontainers/go-digest"
+)
+
+type EventType int
+
+const (
+	// EventUpdated is sent when a refreshed trust root has been loaded.
+	EventUpdated EventType = 1
+	// EventError is sent when updating the trust root failed.
+	EventError EventType = 2
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventUpdated:
+		return "updated"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Type           EventType
+	OldRootVersion int64
+	NewRootVersion int64
+	// ChangedTargets contains the TUF targets that were added, removed or
+	// changed by the update.
+	ChangedTargets map[string]TargetChange
+	Error          error
+}
+
+// TargetChange contains the digests of a TUF target before and after an
+// update. Old is empty for new targets and New is empty for removed ones.
+type TargetChange struct {
+	Old digest.Digest
+	New digest.Digest
+}
+
+// Subscribe registers fn to be called for every trust root update or update
+// error. Events are delivered from the updating goroutine one at a time, so fn
+// should not block. The returned function removes the subscription.
+func (tp *TrustProvider) Subscribe(fn func(Event)) func() {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.subs == nil {
+		tp.subs = map[int]func(Event){}
+	}
+	id := tp.nextSub
+	tp.nextSub++
+	tp.subs[id] = fn
+	return func() {
+		tp.mu.Lock()
+		delete(tp.subs, id)
+		tp.mu.Unlock()
+	}
+}
+
+func (tp *TrustProvider) notify(ev Event) {
+	tp.mu.RLock()
+	subs := make([]func(Event), 0, len(tp.subs))
+	for _, fn := range tp.subs {
+		subs = append(subs, fn)
+	}
+	tp.mu.RUnlock()
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
+func changedTargets(old, cur map[string]digest.Digest) map[string]TargetChange {
+	changes := map[string]TargetChange{}
+	for name, dgst := range cur {
+		if old[name] != dgst {
+			changes[name] = TargetChange{Old: old[name], New: dgst}
+		}
+	}
+	for name, dgst := range old {
+		if _, ok := cur[name]; !ok {
+			changes[name] = TargetChange{Old: dgst}
+		}
+	}
+	return changes
+}
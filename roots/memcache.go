@@ -0,0 +1,114 @@
+package roots
+
+import (
+	"io/fs"
+	"maps"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// memCache holds the TUF state of an in-memory trust provider using the same
+// layout as the cache directory. Metadata downloaded during an update is
+// staged and only committed once the whole update has been verified, so that
+// a failed update does not replace the metadata used while offline.
+type memCache struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	staged map[string][]byte
+}
+
+func newMemCache(seed fs.FS) (*memCache, error) {
+	m := &memCache{
+		files:  map[string][]byte{},
+		staged: map[string][]byte{},
+	}
+	err := fs.WalkDir(seed, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		dt, err := fs.ReadFile(seed, p)
+		if err != nil {
+			return err
+		}
+		m.files[p] = dt
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading seed for in-memory TUF cache")
+	}
+	return m, nil
+}
+
+func (m *memCache) get(p string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dt, ok := m.files[p]
+	return dt, ok
+}
+
+func (m *memCache) set(p string, dt []byte) {
+	m.mu.Lock()
+	m.files[p] = dt
+	m.mu.Unlock()
+}
+
+// metadata returns the metadata file for a path relative to the repository
+// base URL.
+func (m *memCache) metadata(rel string) ([]byte, bool) {
+	p, ok := memCachePath(rel)
+	if !ok {
+		return nil, false
+	}
+	return m.get(p)
+}
+
+// stage records downloaded metadata to be committed after the update.
+func (m *memCache) stage(rel string, dt []byte) {
+	p, ok := memCachePath(rel)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	m.staged[p] = dt
+	m.mu.Unlock()
+}
+
+func (m *memCache) commit() {
+	m.mu.Lock()
+	maps.Copy(m.files, m.staged)
+	clear(m.staged)
+	m.mu.Unlock()
+}
+
+func (m *memCache) discard() {
+	m.mu.Lock()
+	clear(m.staged)
+	m.mu.Unlock()
+}
+
+// memCachePath maps a metadata path in the repository to its location in the
+// cache layout. Versioned roots are kept in roots/ like the on-disk cache does
+// and only the latest version of the other roles is kept. Targets are cached
+// by the TUF client after they have been verified.
+func memCachePath(rel string) (string, bool) {
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" || strings.Contains(rel, "/") || path.Ext(rel) != ".json" {
+		return "", false
+	}
+	if strings.HasSuffix(rel, ".root.json") {
+		return path.Join("roots", rel), true
+	}
+	if v, role, ok := strings.Cut(rel, "."); ok {
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return role, true
+		}
+	}
+	return rel, true
+}
@@ -5,15 +5,20 @@ import (
 	"embed"
 	"io"
 	"io/fs"
+	"maps"
+	"math/rand/v2"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofrs/flock"
+	"github.com/moby/policy-helpers/internal/tufrepo"
 	"github.com/pkg/errors"
 	"github.com/sigstore/sigstore-go/pkg/root"
 	"github.com/sigstore/sigstore-go/pkg/tuf"
@@ -25,146 +30,442 @@ type SigstoreRootsConfig struct {
 	CachePath      string
 	UpdateInterval time.Duration
 	RequireOnline  bool
+	// ExpiryWarningPeriod is how long before the TUF metadata expires
+	// that the status reports it as expiring soon.
+	// Defaults to DefaultExpiryWarningPeriod.
+	ExpiryWarningPeriod time.Duration
+	// WaitTimeout is how long TrustedRoot waits for a pending update before
+	// falling back to the previous trust root, and for the lock on CachePath
+	// if a target is not in memory yet. Defaults to DefaultWaitTimeout.
+	WaitTimeout time.Duration
+	// RetryBackoff is the delay before retrying a failed update. It doubles
+	// with every consecutive failure up to MaxRetryBackoff and is randomized
+	// so that many clients don't retry at the same time.
+	// Defaults to DefaultRetryBackoff and DefaultMaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// HTTPClient is used to fetch from the TUF repository, e.g. to configure
+	// a proxy or custom CA certificates. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// RequestTimeout limits the duration of a single request to the TUF
+	// repository if HTTPClient has no timeout of its own.
+	// Defaults to DefaultRequestTimeout.
+	RequestTimeout time.Duration
+	// NewFetcher creates the fetcher for the TUF repository. If set,
+	// HTTPClient and RequestTimeout are not used.
+	NewFetcher func() (fetcher.Fetcher, error)
+	// Mirrors are base URLs of mirrors of the TUF repository. They are tried
+	// in order instead of the upstream repository URL.
+	Mirrors []string
+	// LockTimeout is how long to wait for another process holding the lock
+	// on CachePath. Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+	// InMemory keeps the TUF state in memory so that nothing is written to
+	// disk. The state is seeded from CachePath if it contains a populated
+	// cache, which may be read-only, or from the embedded root otherwise.
+	// Updates are kept for the lifetime of the trust provider.
+	InMemory bool
+
+	// repository replaces the Sigstore public good instance, see
+	// tufrepo.SetRepository
+	repository *tufrepo.Repository
+}
+
+func init() {
+	tufrepo.SetRepository = func(cfg any, r tufrepo.Repository) {
+		cfg.(*SigstoreRootsConfig).repository = &r
+	}
 }
 
 type TrustProvider struct {
-	mu      sync.RWMutex
-	config  SigstoreRootsConfig
-	client  *tuf.Client
-	fetcher *airgappedFetcher
+	mu       sync.RWMutex
+	config   SigstoreRootsConfig
+	repo     repository
+	cacheDir string
+	client   *tufClient
+	fetcher  *airgappedFetcher
+	// mem holds the TUF state if the trust provider is in memory
+	mem *memCache
 
 	status Status
+	// lockContended is set when the last attempt to lock the cache had to
+	// wait for another process
+	lockContended bool
+	// updating is closed when the in-flight update finishes
+	updating chan struct{}
+	failures int
+	clock    clock
+
+	subs    map[int]func(Event)
+	nextSub int
+
+	// targets are the names of the targets that have been requested and
+	// are refreshed with every update
+	targets map[string]struct{}
+	// verified holds the content of the requested targets verified against
+	// the metadata of client, so that readers don't need the cache lock
+	verified map[string][]byte
+
+	closed bool
+	done   chan struct{}
+	// ctx is canceled on Close to abort background updates waiting for the
+	// cache lock
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
 }
 
 type Status struct {
-	Error       error      `json:"error,omitempty"`
-	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	Error       error           `json:"error,omitempty"`
+	LastUpdated *time.Time      `json:"lastUpdated,omitempty"`
+	Expiry      *MetadataExpiry `json:"expiry,omitempty"`
+	// NextRetry is when a failed update is retried next.
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+	// Mirror is the base URL that served the last update.
+	Mirror string `json:"mirror,omitempty"`
+	// ExpiresSoon is set when some of the TUF metadata is expired or
+	// expires within the configured warning period.
+	ExpiresSoon bool `json:"expiresSoon,omitempty"`
+	// LockContended is set when the cache directory was locked by another
+	// process the last time the trust provider accessed it.
+	LockContended bool `json:"lockContended,omitempty"`
 }
 
+// ErrClosed is returned when a closed trust provider is used.
+var ErrClosed = errors.New("trust provider is closed")
+
+// ErrLockTimeout is returned when the cache directory stays locked by another
+// process for longer than the configured LockTimeout.
+var ErrLockTimeout = errors.New("timed out waiting for lock on trust provider cache")
+
 const (
 	trustedRootFilename = "trusted_root.json"
+
+	DefaultExpiryWarningPeriod = 48 * time.Hour
+	DefaultWaitTimeout         = 5 * time.Second
+	DefaultRetryBackoff        = 10 * time.Second
+	DefaultMaxRetryBackoff     = 15 * time.Minute
+	DefaultRequestTimeout      = time.Minute
+	DefaultLockTimeout         = 30 * time.Second
+
+	lockRetryDelay = 50 * time.Millisecond
 )
 
+// repository describes the TUF repository tracked by the trust provider.
+type repository struct {
+	baseURL string
+	// root is the initial trusted root metadata
+	root []byte
+	// seed is copied into an empty cache directory
+	seed fs.FS
+}
+
+func sigstoreRepository() (repository, error) {
+	dt, err := EmbeddedTUF.ReadFile("tuf-root/root.json")
+	if err != nil {
+		return repository{}, errors.WithStack(err)
+	}
+	seed, err := fs.Sub(EmbeddedTUF, "tuf-root")
+	if err != nil {
+		return repository{}, errors.WithStack(err)
+	}
+	return repository{
+		baseURL: tuf.DefaultMirror,
+		root:    dt,
+		seed:    seed,
+	}, nil
+}
+
 func NewTrustProvider(cfg SigstoreRootsConfig) (*TrustProvider, error) {
-	if cfg.CachePath == "" {
-		return nil, errors.Errorf("cache path must be provided for trust provider")
+	if r := cfg.repository; r != nil {
+		if r.URL == "" || len(r.Root) == 0 {
+			return nil, errors.Errorf("TUF repository needs a URL and root metadata")
+		}
+		repo := repository{
+			baseURL: r.URL,
+			root:    r.Root,
+			seed:    r.Seed,
+		}
+		if repo.seed == nil {
+			// the zero value is an empty file system
+			repo.seed = embed.FS{}
+		}
+		return newTrustProvider(cfg, repo, realClock{})
 	}
-	def := tuf.DefaultOptions()
-	cacheDir := filepath.Join(cfg.CachePath, tuf.URLToPath(def.RepositoryBaseURL))
-	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
-		return nil, errors.Wrap(err, "creating cache directory for trust provider")
+	repo, err := sigstoreRepository()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading embedded TUF root")
 	}
+	return newTrustProvider(cfg, repo, realClock{})
+}
 
-	tp := &TrustProvider{
-		config: cfg,
+func newTrustProvider(cfg SigstoreRootsConfig, repo repository, clk clock) (*TrustProvider, error) {
+	if cfg.CachePath == "" && !cfg.InMemory {
+		return nil, errors.Errorf("cache path must be provided for trust provider")
 	}
+	cacheDir := filepath.Join(cfg.CachePath, tuf.URLToPath(repo.baseURL))
 
-	unlock, err := tp.lock()
+	if cfg.ExpiryWarningPeriod == 0 {
+		cfg.ExpiryWarningPeriod = DefaultExpiryWarningPeriod
+	}
+	if cfg.WaitTimeout == 0 {
+		cfg.WaitTimeout = DefaultWaitTimeout
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff == 0 {
+		cfg.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = DefaultRequestTimeout
+	}
+	if cfg.LockTimeout == 0 {
+		cfg.LockTimeout = DefaultLockTimeout
+	}
+	if len(cfg.Mirrors) == 0 {
+		cfg.Mirrors = []string{repo.baseURL}
+	}
+	onlineFetcher, err := newFetcher(cfg)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "creating fetcher for trust provider")
 	}
-	defer unlock()
 
-	root, err := os.OpenRoot(cacheDir)
-	if err != nil {
-		return nil, errors.Wrap(err, "opening cache directory for trust provider")
+	tp := &TrustProvider{
+		config:   cfg,
+		repo:     repo,
+		cacheDir: cacheDir,
+		clock:    clk,
+		done:     make(chan struct{}),
+		targets:  map[string]struct{}{trustedRootFilename: {}},
+		verified: map[string][]byte{},
 	}
-	defer root.Close()
-	if _, err := root.Lstat("root.json"); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, errors.Wrap(err, "statting root.json in cache directory for trust provider")
+
+	if cfg.InMemory {
+		seed := repo.seed
+		if cfg.CachePath != "" {
+			if _, err := os.Stat(filepath.Join(cacheDir, "root.json")); err == nil {
+				seed = os.DirFS(cacheDir)
+			} else if !os.IsNotExist(err) {
+				return nil, errors.Wrap(err, "statting root.json in cache directory for trust provider")
+			}
 		}
-		if err := copyEmbeddedRoot(EmbeddedTUF, root); err != nil {
-			return nil, errors.Wrap(err, "initializing cache directory for trust provider with embedded root")
+		tp.mem, err = newMemCache(seed)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+			return nil, errors.Wrap(err, "creating cache directory for trust provider")
 		}
 	}
 
 	agf := &airgappedFetcher{
-		baseURL:       def.RepositoryBaseURL,
+		baseURL:       repo.baseURL,
 		cacheDir:      cacheDir,
-		onlineFetcher: fetcher.NewDefaultFetcher(),
-		isOnline:      true,
+		onlineFetcher: onlineFetcher,
+		mirrors:       cfg.Mirrors,
+		mem:           tp.mem,
+		// in memory there is no local metadata for the TUF client to
+		// start from, so load it through the offline fetcher first unless
+		// online is required
+		isOnline: tp.mem == nil || cfg.RequireOnline,
 	}
 	tp.fetcher = agf
 
-	tufOpts, err := tp.tufClientOpts()
+	c, err := tp.load()
 	if err != nil {
-		return nil, errors.Wrap(err, "creating TUF client options for trust provider")
+		return nil, err
+	}
+	tp.client = c
+	expiry := c.Expiry()
+	tp.status.Expiry = &expiry
+	agf.isOnline = true
+
+	tp.ctx, tp.cancel = context.WithCancelCause(context.Background())
+	tp.startUpdate()
+
+	if cfg.UpdateInterval > 0 {
+		tp.wg.Add(1)
+		go tp.run()
 	}
 
-	c, err := tuf.New(tufOpts)
+	return tp, nil
+}
+
+// load creates the initial TUF client from the cache. The lock on the cache is
+// released before the first update starts.
+func (tp *TrustProvider) load() (*tufClient, error) {
+	unlock, err := tp.lock(context.Background(), true)
 	if err != nil {
-		// try again with airgapped fetcher
-		// this can still fail if the last root or timestamps file has expired
+		return nil, err
+	}
+	defer unlock()
 
-		agf.isOnline = false
-		tufOpts, err := tp.tufClientOpts()
+	if tp.mem == nil {
+		root, err := os.OpenRoot(tp.cacheDir)
 		if err != nil {
-			return nil, errors.Wrap(err, "creating TUF client options for trust provider with airgapped fetcher")
+			return nil, errors.Wrap(err, "opening cache directory for trust provider")
+		}
+		defer root.Close()
+		if _, err := root.Lstat("root.json"); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, errors.Wrap(err, "statting root.json in cache directory for trust provider")
+			}
+			if err := seedCache(tp.repo.seed, root); err != nil {
+				return nil, errors.Wrap(err, "initializing cache directory for trust provider with embedded root")
+			}
 		}
-		c, err = tuf.New(tufOpts)
+	}
+
+	c, err := tp.newClient(tp.config.CachePath)
+	if err != nil {
+		// try again with airgapped fetcher
+		// this can still fail if the last root or timestamps file has expired
+
+		tp.fetcher.isOnline = !tp.fetcher.isOnline
+		c, err = tp.newClient(tp.config.CachePath)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 	}
-	tp.client = c
-	agf.isOnline = true
+	if tp.mem != nil {
+		tp.mem.commit()
+	}
+	return c, nil
+}
 
-	go tp.update()
+// run updates the trust root every UpdateInterval, or sooner when a failed
+// update needs to be retried.
+func (tp *TrustProvider) run() {
+	defer tp.wg.Done()
+	for {
+		tp.mu.RLock()
+		updating := tp.updating
+		next := tp.config.UpdateInterval
+		if tp.status.NextRetry != nil {
+			next = min(next, tp.status.NextRetry.Sub(tp.clock.Now()))
+		}
+		tp.mu.RUnlock()
 
-	if cfg.UpdateInterval > 0 {
-		go func() {
-			ticker := time.NewTicker(cfg.UpdateInterval)
-			defer ticker.Stop()
-			// TODO: stop condition
-			for range ticker.C {
-				tp.update()
+		if updating != nil {
+			select {
+			case <-updating:
+				continue
+			case <-tp.done:
+				return
+			}
+		}
+
+		select {
+		case <-tp.clock.After(next):
+			if _, err := tp.startUpdate(); err != nil {
+				return
 			}
-		}()
+		case <-tp.done:
+			return
+		}
 	}
+}
 
-	return tp, nil
+// Close stops the background updates of the trust provider and waits for
+// the in-flight ones to finish. Calls after Close return ErrClosed.
+func (tp *TrustProvider) Close() error {
+	tp.mu.Lock()
+	if tp.closed {
+		tp.mu.Unlock()
+		return nil
+	}
+	tp.closed = true
+	close(tp.done)
+	tp.mu.Unlock()
+	tp.cancel(errors.WithStack(ErrClosed))
+
+	tp.wg.Wait()
+	return nil
 }
 
-func (tp *TrustProvider) tufClientOpts() (*tuf.Options, error) {
-	def := tuf.DefaultOptions()
-	cacheDir := filepath.Join(tp.config.CachePath, tuf.URLToPath(def.RepositoryBaseURL))
-	root, err := os.OpenRoot(cacheDir)
-	if err != nil {
-		return nil, errors.Wrap(err, "opening cache directory for trust provider")
+func (tp *TrustProvider) tufClientOpts(cachePath string) *tuf.Options {
+	var f fetcher.Fetcher = tp.fetcher
+	if tp.mem == nil && cachePath != tp.config.CachePath {
+		// the root chain downloaded by a staged update is committed with it
+		f = &stagedFetcher{
+			airgappedFetcher: tp.fetcher,
+			cacheDir:         filepath.Join(cachePath, tuf.URLToPath(tp.repo.baseURL)),
+		}
 	}
-	defer root.Close()
+	return &tuf.Options{
+		Root:              tp.repo.root,
+		CachePath:         cachePath,
+		RepositoryBaseURL: tp.repo.baseURL,
+		ForceCache:        !tp.config.RequireOnline,
+		DisableLocalCache: tp.mem != nil,
+		Fetcher:           f,
+	}
+}
 
-	dt, err := EmbeddedTUF.ReadFile("tuf-root/root.json")
-	if err != nil {
-		return nil, err
+// newClient creates a TUF client from the state cached in cachePath. For an
+// in-memory trust provider, the metadata it downloads stays staged until
+// committed.
+func (tp *TrustProvider) newClient(cachePath string) (*tufClient, error) {
+	if tp.mem != nil {
+		tp.mem.discard()
+	}
+	return newTUFClient(tp.tufClientOpts(cachePath), tp.mem)
+}
+
+// startUpdate runs update in a goroutine unless one is already in flight.
+// The returned channel is closed when that update finishes.
+func (tp *TrustProvider) startUpdate() (<-chan struct{}, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.closed {
+		return nil, errors.WithStack(ErrClosed)
+	}
+	if tp.updating != nil {
+		return tp.updating, nil
 	}
-	def.Root = dt
-	def.CachePath = tp.config.CachePath
-	def.ForceCache = !tp.config.RequireOnline
-	def.Fetcher = tp.fetcher
-	return def, nil
+	ch := make(chan struct{})
+	tp.updating = ch
+	tp.wg.Add(1)
+	go func() {
+		defer tp.wg.Done()
+		tp.update()
+		tp.mu.Lock()
+		tp.updating = nil
+		close(ch)
+		tp.mu.Unlock()
+	}()
+	return ch, nil
 }
 
 func (tp *TrustProvider) update() (err error) {
+	var ev Event
 	defer func() {
 		if err != nil {
 			tp.mu.Lock()
+			tp.failures++
+			next := tp.clock.Now().Add(tp.retryDelay(tp.failures))
 			tp.status.Error = err
+			tp.status.NextRetry = &next
 			tp.mu.Unlock()
+			ev = Event{Type: EventError, Error: err}
 		}
+		tp.notify(ev)
 	}()
 
-	unlock, err := tp.lock()
-	if err != nil {
-		return err
-	}
-	defer unlock()
-	tufOpts, err := tp.tufClientOpts()
-	if err != nil {
-		return errors.Wrap(err, "creating TUF client options for trust provider")
+	// on disk, the update is done in a copy of the cache so that the
+	// cache is only locked exclusively to commit it
+	cachePath := tp.config.CachePath
+	if tp.mem == nil {
+		cachePath, err = tp.stage()
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(cachePath)
 	}
-	c, err := tuf.New(tufOpts)
+	c, err := tp.newClient(cachePath)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -172,86 +473,457 @@ func (tp *TrustProvider) update() (err error) {
 	if err != nil {
 		return err
 	}
+	if err := checkRollback(tp.client, c); err != nil {
+		return err
+	}
+	if tp.mem != nil {
+		tp.mem.commit()
+	}
+	// fetch the requested targets with the update so that they are
+	// available to readers without the cache, also while offline
+	tp.mu.RLock()
+	names := slices.Sorted(maps.Keys(tp.targets))
+	tp.mu.RUnlock()
+	verified := map[string][]byte{}
+	available := c.Targets()
+	for _, name := range names {
+		if _, ok := available[name]; !ok {
+			continue
+		}
+		dt, err := c.GetTarget(name)
+		if err != nil {
+			return err
+		}
+		verified[name] = dt
+	}
+	if tp.mem == nil {
+		var committed bool
+		c, committed, err = tp.commit(c, cachePath)
+		if err != nil {
+			return err
+		}
+		if !committed {
+			// the cache has newer metadata than the update, so the
+			// targets are read from there again
+			verified = map[string][]byte{}
+		}
+	}
+	expiry := c.Expiry()
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
-	now := time.Now().UTC()
-	tp.status = Status{LastUpdated: &now}
+	now := tp.clock.Now().UTC()
+	tp.status = Status{LastUpdated: &now, Expiry: &expiry, Mirror: tp.fetcher.lastMirror()}
+	old := tp.client
 	tp.client = c
+	tp.verified = verified
+	tp.failures = 0
+	ev = Event{
+		Type:           EventUpdated,
+		OldRootVersion: old.RootVersion(),
+		NewRootVersion: c.RootVersion(),
+		ChangedTargets: changedTargets(old.Targets(), c.Targets()),
+	}
+	return nil
+}
+
+// stage copies the cache under a shared lock into a temporary directory in
+// the cache path that is returned as the cache path for the update.
+func (tp *TrustProvider) stage() (_ string, retErr error) {
+	dir, err := os.MkdirTemp(tp.config.CachePath, ".update-")
+	if err != nil {
+		return "", errors.Wrap(err, "creating staging directory for trust provider update")
+	}
+	defer func() {
+		if retErr != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	stagingDir := filepath.Join(dir, tuf.URLToPath(tp.repo.baseURL))
+	if err := os.MkdirAll(stagingDir, 0o755); err != nil {
+		return "", errors.Wrap(err, "creating staging directory for trust provider update")
+	}
+	root, err := os.OpenRoot(stagingDir)
+	if err != nil {
+		return "", errors.Wrap(err, "opening staging directory for trust provider update")
+	}
+	defer root.Close()
+
+	unlock, err := tp.lock(tp.ctx, false)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := seedCache(os.DirFS(tp.cacheDir), root); err != nil {
+		return "", errors.Wrap(err, "copying cache directory for trust provider update")
+	}
+	return dir, nil
+}
+
+// commit copies the update staged in cachePath into the cache under the
+// exclusive lock and returns c pointed at the cache. If another process has
+// committed newer metadata in the meantime, that is kept and a client for it
+// is returned instead.
+func (tp *TrustProvider) commit(c *tufClient, cachePath string) (*tufClient, bool, error) {
+	unlock, err := tp.lock(tp.ctx, true)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	timestamp, _ := c.Versions()
+	if cached, err := cachedTimestampVersion(tp.cacheDir); err == nil && cached > timestamp {
+		cc, err := newCachedTUFClient(tp.tufClientOpts(tp.config.CachePath))
+		if err != nil {
+			return nil, false, errors.Wrap(err, "loading newer metadata from trust provider cache")
+		}
+		return cc, false, nil
+	}
+
+	root, err := os.OpenRoot(tp.cacheDir)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "opening cache directory for trust provider")
+	}
+	defer root.Close()
+	if err := seedCache(os.DirFS(filepath.Join(cachePath, tuf.URLToPath(tp.repo.baseURL))), root); err != nil {
+		return nil, false, errors.Wrap(err, "committing trust provider update to cache directory")
+	}
+	c.Move(tp.cacheDir)
+	return c, true, nil
+}
+
+// cachedTimestampVersion returns the version of the timestamp metadata in the
+// cache directory.
+func cachedTimestampVersion(dir string) (int64, error) {
+	dt, err := os.ReadFile(filepath.Join(dir, metadata.TIMESTAMP+".json"))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	md, err := metadata.Timestamp().FromBytes(dt)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return md.Signed.Version, nil
+}
+
+// checkRollback returns an error if the metadata of the new client is older
+// than the metadata it replaces. go-tuf already checks this against the local
+// metadata on disk, but an in-memory client has no local metadata to start
+// from.
+func checkRollback(old, c *tufClient) error {
+	oldTimestamp, oldSnapshot := old.Versions()
+	timestamp, snapshot := c.Versions()
+	if timestamp < oldTimestamp {
+		return errors.Errorf("timestamp version %d is older than trusted version %d", timestamp, oldTimestamp)
+	}
+	if snapshot < oldSnapshot {
+		return errors.Errorf("snapshot version %d is older than trusted version %d", snapshot, oldSnapshot)
+	}
 	return nil
 }
 
-func (tp *TrustProvider) wait(ctx context.Context) (*tuf.Client, error) {
-	first := true
-	errCh := make(chan error, 1)
+// retryDelay returns the randomized exponential backoff after the given
+// number of consecutive failed updates.
+func (tp *TrustProvider) retryDelay(failures int) time.Duration {
+	d := tp.config.RetryBackoff
+	for i := 1; i < failures && d < tp.config.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, tp.config.MaxRetryBackoff)
+	return d/2 + rand.N(d/2+1) //nolint:gosec // jitter does not need a secure random source
+}
+
+// wait waits for the trust root to be updated from the TUF repository. A
+// failed update is retried once, but not before its backoff has passed. If
+// sleep is false, wait returns the last error instead of sleeping through the
+// backoff.
+func (tp *TrustProvider) wait(ctx context.Context, sleep bool) (*tufClient, error) {
+	waited := false
 	for {
 		tp.mu.RLock()
 		status := tp.status
 		client := tp.client
+		var updating <-chan struct{} = tp.updating
 		tp.mu.RUnlock()
 		if status.LastUpdated != nil && status.Error == nil {
 			return client, nil
 		}
-		// try update if we are in error from some old reason that might be resolved now
-		if status.Error != nil && first {
-			go func() {
-				errCh <- tp.update()
-			}()
-			first = false
+		if updating == nil {
+			if waited {
+				return nil, status.Error
+			}
+			if status.NextRetry != nil {
+				if d := status.NextRetry.Sub(tp.clock.Now()); d > 0 {
+					if !sleep {
+						return nil, status.Error
+					}
+					select {
+					case <-tp.clock.After(d):
+						continue
+					case <-ctx.Done():
+						return nil, context.Cause(ctx)
+					case <-tp.done:
+						return nil, errors.WithStack(ErrClosed)
+					}
+				}
+			}
+			// try update if we are in error from some old reason that might be resolved now
+			ch, err := tp.startUpdate()
+			if err != nil {
+				return nil, err
+			}
+			updating = ch
 		}
 		select {
-		case err := <-errCh:
-			if err == nil {
-				continue
-			}
-			return nil, err
+		case <-updating:
+			waited = true
 		case <-ctx.Done():
 			return nil, context.Cause(ctx)
-		case <-time.After(100 * time.Millisecond):
+		case <-tp.done:
+			return nil, errors.WithStack(ErrClosed)
 		}
 	}
 }
 
-func (tp *TrustProvider) lock() (func() error, error) {
+// WaitReady blocks until the trust root has been updated from the TUF
+// repository. If the last update failed, it is retried once after its
+// backoff and the error is returned if it fails again.
+func (tp *TrustProvider) WaitReady(ctx context.Context) error {
+	_, err := tp.wait(ctx, true)
+	return err
+}
+
+// lock locks the cache directory against other processes. Writers take an
+// exclusive lock, readers a shared one. Waiting for the lock is bounded by ctx
+// and the configured LockTimeout.
+func (tp *TrustProvider) lock(ctx context.Context, exclusive bool) (func() error, error) {
+	if tp.mem != nil {
+		return func() error { return nil }, nil
+	}
 	lockPath := path.Join(tp.config.CachePath, ".lock")
 	fileLock := flock.New(lockPath)
-	if err := fileLock.Lock(); err != nil {
+	tryLock, tryLockContext := fileLock.TryRLock, fileLock.TryRLockContext
+	if exclusive {
+		tryLock, tryLockContext = fileLock.TryLock, fileLock.TryLockContext
+	}
+
+	locked, err := tryLock()
+	if err != nil {
+		return nil, errors.Wrap(err, "acquiring lock on trust provider cache")
+	}
+	tp.mu.Lock()
+	tp.lockContended = !locked
+	tp.mu.Unlock()
+	if locked {
+		return fileLock.Unlock, nil
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, tp.config.LockTimeout, errors.WithStack(ErrLockTimeout))
+	defer cancel()
+	locked, err = tryLockContext(ctx, lockRetryDelay)
+	if !locked {
+		if ctxErr := context.Cause(ctx); ctxErr != nil {
+			err = ctxErr
+		}
 		return nil, errors.Wrap(err, "acquiring lock on trust provider cache")
 	}
 	return fileLock.Unlock, nil
 }
 
+// target returns a TUF target from the cache under a shared lock. A target
+// that is not cached yet is downloaded without holding the lock and the
+// exclusive lock is only taken to store it.
+func (tp *TrustProvider) target(ctx context.Context, client *tufClient, name string) ([]byte, error) {
+	unlock, err := tp.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	dt, ok, err := client.CachedTarget(name)
+	unlock()
+	if err != nil || ok {
+		return dt, err
+	}
+
+	dt, err = client.DownloadTarget(name)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err = tp.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := client.StoreTarget(name, dt); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
 func (tp *TrustProvider) TrustedRoot(ctx context.Context) (*root.TrustedRoot, Status, error) {
+	jsonBytes, st, err := tp.Target(ctx, trustedRootFilename)
+	if err != nil {
+		return nil, st, err
+	}
+	tr, err := root.NewTrustedRootFromJSON(jsonBytes)
+	return tr, st, err
+}
+
+// Target returns the content of a target from the TUF repository, such as a
+// signing config or a keyring. Like the trusted root, a target is verified
+// against the TUF metadata and cached. Once requested, it is refreshed with
+// every update so that it stays available while offline.
+func (tp *TrustProvider) Target(ctx context.Context, name string) ([]byte, Status, error) {
 	ctx, cnclFn := context.WithCancelCause(ctx)
-	ctx, _ = context.WithTimeoutCause(ctx, time.Second*5, errors.WithStack(context.DeadlineExceeded)) //nolint:govet
 	defer cnclFn(errors.WithStack(context.Canceled))
+	waitCtx, cancelTimeout := context.WithTimeoutCause(ctx, tp.config.WaitTimeout, errors.WithStack(context.DeadlineExceeded))
+	defer cancelTimeout()
 
-	var st Status
-	client, err := tp.wait(ctx)
+	tp.mu.RLock()
+	closed := tp.closed
+	tp.mu.RUnlock()
+	if closed {
+		return nil, Status{}, errors.WithStack(ErrClosed)
+	}
+
+	_, err := tp.wait(waitCtx, false)
+	if errors.Is(err, ErrClosed) {
+		return nil, Status{}, err
+	}
+	tp.mu.RLock()
+	st := tp.status
 	if err != nil { // return indication of last refresh error? TODO(@tonistiigi) does this make GetTarget fail as well and separate instance of client is needed for optional refresh?
 		st.Error = err
+	}
+	client := tp.client
+	dt, ok := tp.verified[name]
+	tp.mu.RUnlock()
+	if st.Expiry != nil {
+		if _, t := st.Expiry.Earliest(); !t.IsZero() {
+			st.ExpiresSoon = t.Sub(tp.clock.Now()) < tp.config.ExpiryWarningPeriod
+		}
+	}
+	if ok {
 		tp.mu.RLock()
-		client = tp.client
+		st.LockContended = tp.lockContended
 		tp.mu.RUnlock()
+		return dt, st, nil
 	}
 
-	jsonBytes, err := client.GetTarget(trustedRootFilename)
+	// waiting for the lock is bounded like waiting for an update as the
+	// cache may be locked by a slow update in another process
+	dt, err = tp.target(waitCtx, client, name)
+	tp.mu.Lock()
+	st.LockContended = tp.lockContended
+	if err == nil {
+		tp.targets[name] = struct{}{}
+		if tp.client == client {
+			tp.verified[name] = dt
+		}
+	}
+	tp.mu.Unlock()
 	if err != nil {
 		return nil, st, err
 	}
-	tr, err := root.NewTrustedRootFromJSON(jsonBytes)
-	return tr, st, err
+	return dt, st, nil
+}
+
+func newFetcher(cfg SigstoreRootsConfig) (fetcher.Fetcher, error) {
+	if cfg.NewFetcher != nil {
+		return cfg.NewFetcher()
+	}
+	hc := http.DefaultClient
+	if cfg.HTTPClient != nil {
+		hc = cfg.HTTPClient
+	}
+	// copy so that the timeout does not affect other users of the client
+	c := *hc
+	if c.Timeout == 0 {
+		c.Timeout = cfg.RequestTimeout
+	}
+	f := fetcher.NewDefaultFetcher()
+	f.SetHTTPClient(&c)
+	return f, nil
 }
 
 type airgappedFetcher struct {
 	baseURL       string
 	cacheDir      string
 	onlineFetcher fetcher.Fetcher
+	mirrors       []string
 	isOnline      bool
+	// mem replaces cacheDir if the trust provider is in memory
+	mem *memCache
+
+	mu     sync.Mutex
+	mirror string
+}
+
+// download fetches urlPath from the first mirror that has it. A not found
+// response is preferred over other errors so that an unreachable mirror does
+// not hide that e.g. no newer root exists.
+func (f *airgappedFetcher) download(urlPath string, maxLength int64, dur time.Duration) ([]byte, error) {
+	rel, ok := strings.CutPrefix(urlPath, f.baseURL)
+	if !ok {
+		return f.onlineFetcher.DownloadFile(urlPath, maxLength, dur)
+	}
+	var notFoundErr, lastErr error
+	for _, m := range f.mirrors {
+		dt, err := f.onlineFetcher.DownloadFile(strings.TrimSuffix(m, "/")+rel, maxLength, dur)
+		if err == nil {
+			if rel == "/timestamp.json" {
+				f.mu.Lock()
+				f.mirror = m
+				f.mu.Unlock()
+			}
+			return dt, nil
+		}
+		var httpErr *metadata.ErrDownloadHTTP
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			notFoundErr = err
+		} else {
+			lastErr = err
+		}
+	}
+	if notFoundErr != nil {
+		return nil, notFoundErr
+	}
+	return nil, lastErr
+}
+
+// lastMirror returns the mirror that served the latest timestamp.
+func (f *airgappedFetcher) lastMirror() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mirror
 }
 
 func (f *airgappedFetcher) DownloadFile(urlPath string, maxLength int64, dur time.Duration) ([]byte, error) {
+	return f.downloadFile(f.cacheDir, urlPath, maxLength, dur)
+}
+
+// downloadFile is DownloadFile with the root chain and the offline metadata
+// kept in cacheDir.
+func (f *airgappedFetcher) downloadFile(cacheDir, urlPath string, maxLength int64, dur time.Duration) ([]byte, error) {
+	if f.mem != nil {
+		rel, ok := strings.CutPrefix(urlPath, f.baseURL)
+		if !f.isOnline {
+			if dt, found := f.mem.metadata(rel); ok && found {
+				return dt, nil
+			}
+			return nil, &metadata.ErrDownloadHTTP{
+				StatusCode: 404,
+			}
+		}
+		dt, err := f.download(urlPath, maxLength, dur)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			f.mem.stage(rel, dt)
+		}
+		return dt, nil
+	}
 	if f.isOnline {
-		dt, err := f.onlineFetcher.DownloadFile(urlPath, maxLength, dur)
+		dt, err := f.download(urlPath, maxLength, dur)
 		if err != nil {
 			return nil, err
 		}
@@ -260,12 +932,12 @@ func (f *airgappedFetcher) DownloadFile(urlPath string, maxLength int64, dur tim
 		if err != nil {
 			return nil, errors.Wrap(err, "parsing URL in trust provider fetcher")
 		}
-		cache, err := os.OpenRoot(f.cacheDir)
-		if err != nil {
-			return nil, errors.Wrap(err, "opening cache directory for trust provider")
-		}
-		defer cache.Close()
 		if strings.HasSuffix(u.Path, ".root.json") {
+			cache, err := os.OpenRoot(cacheDir)
+			if err != nil {
+				return nil, errors.Wrap(err, "opening cache directory for trust provider")
+			}
+			defer cache.Close()
 			base := path.Base(u.Path)
 			if err := cache.MkdirAll("roots", 0o755); err != nil {
 				return nil, errors.Wrap(err, "creating roots directory in trust provider cache")
@@ -278,7 +950,7 @@ func (f *airgappedFetcher) DownloadFile(urlPath string, maxLength int64, dur tim
 	}
 	const timestampFilename = "timestamp.json"
 	if urlPath == f.baseURL+"/"+timestampFilename {
-		cache, err := os.OpenRoot(f.cacheDir)
+		cache, err := os.OpenRoot(cacheDir)
 		if err != nil {
 			return nil, errors.Wrap(err, "opening cache directory for trust provider")
 		}
@@ -292,7 +964,7 @@ func (f *airgappedFetcher) DownloadFile(urlPath string, maxLength int64, dur tim
 		if err == nil {
 			base := path.Base(u.Path)
 			if urlPath == f.baseURL+"/"+base && strings.HasSuffix(base, ".root.json") {
-				cache, err := os.OpenRoot(f.cacheDir)
+				cache, err := os.OpenRoot(cacheDir)
 				if err != nil {
 					return nil, errors.Wrap(err, "opening cache directory for trust provider")
 				}
@@ -309,19 +981,26 @@ func (f *airgappedFetcher) DownloadFile(urlPath string, maxLength int64, dur tim
 	}
 }
 
-func copyEmbeddedRoot(src embed.FS, dest *os.Root) error {
-	subFS, err := fs.Sub(src, "tuf-root")
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return fs.WalkDir(subFS, ".", func(p string, d fs.DirEntry, err error) error {
+// stagedFetcher is the fetcher of a staged update. It keeps the root chain in
+// the staging directory until the update is committed to the cache.
+type stagedFetcher struct {
+	*airgappedFetcher
+	cacheDir string
+}
+
+func (f *stagedFetcher) DownloadFile(urlPath string, maxLength int64, dur time.Duration) ([]byte, error) {
+	return f.downloadFile(f.cacheDir, urlPath, maxLength, dur)
+}
+
+func seedCache(src fs.FS, dest *os.Root) error {
+	return fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() {
 			return dest.MkdirAll(p, 0o755)
 		}
-		in, err := subFS.Open(p)
+		in, err := src.Open(p)
 		if err != nil {
 			return err
 		}
@@ -341,3 +1020,19 @@ func copyEmbeddedRoot(src embed.FS, dest *os.Root) error {
 		return out.Close()
 	})
 }
+
+// clock allows tests to control the scheduling of updates.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,786 @@
+package roots
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/moby/policy-helpers/internal/tufrepo"
+	"github.com/moby/policy-helpers/internal/tuftest"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata/fetcher"
+	"go.uber.org/goleak"
+)
+
+func TestTrustProviderClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:      t.TempDir(),
+		NewFetcher:     repo.NewFetcher,
+		UpdateInterval: 10 * time.Millisecond,
+	}, testRepository(repo), realClock{})
+	require.NoError(t, err)
+
+	tr, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.NoError(t, st.Error)
+	require.NotNil(t, st.LastUpdated)
+
+	require.NoError(t, tp.Close())
+
+	_, _, err = tp.TrustedRoot(t.Context())
+	require.ErrorIs(t, err, ErrClosed)
+
+	// closing again is a no-op
+	require.NoError(t, tp.Close())
+}
+
+func TestTrustProviderCloseWhileFailing(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:      t.TempDir(),
+		NewFetcher:     repo.NewFetcher,
+		UpdateInterval: time.Millisecond,
+		RetryBackoff:   time.Millisecond,
+	}, testRepository(repo), realClock{})
+	require.NoError(t, err)
+
+	repo.SetError(errors.New("network unreachable"))
+	require.Eventually(t, func() bool {
+		tp.mu.RLock()
+		defer tp.mu.RUnlock()
+		return tp.status.Error != nil
+	}, 5*time.Second, time.Millisecond)
+
+	// stale root is still returned with the update error
+	tr, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.Error(t, st.Error)
+
+	require.NoError(t, tp.Close())
+	_, _, err = tp.TrustedRoot(t.Context())
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestTrustProviderWaitReady(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	clk := newFakeClock()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  t.TempDir(),
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), clk)
+	require.NoError(t, err)
+	defer tp.Close()
+
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	repo.SetError(errors.New("network unreachable"))
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+
+	// no retry is attempted before the backoff has passed
+	requests := repo.RequestCount()
+	_, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.ErrorContains(t, st.Error, "network unreachable")
+	require.NotNil(t, st.NextRetry)
+	require.Equal(t, requests, repo.RequestCount())
+
+	repo.SetError(nil)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tp.WaitReady(t.Context())
+	}()
+	require.Eventually(t, func() bool {
+		return clk.waiters() > 0
+	}, 5*time.Second, time.Millisecond)
+	clk.Advance(DefaultRetryBackoff)
+	require.NoError(t, <-errCh)
+
+	_, st, err = tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, st.Error)
+	require.Nil(t, st.NextRetry)
+}
+
+func TestTrustProviderRetryBackoff(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	clk := newFakeClock()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:       t.TempDir(),
+		NewFetcher:      repo.NewFetcher,
+		UpdateInterval:  time.Hour,
+		RetryBackoff:    time.Minute,
+		MaxRetryBackoff: 3 * time.Minute,
+	}, testRepository(repo), clk)
+	require.NoError(t, err)
+	defer tp.Close()
+
+	require.NoError(t, tp.WaitReady(t.Context()))
+	repo.SetError(errors.New("network unreachable"))
+
+	status := func() (Status, int) {
+		tp.mu.RLock()
+		defer tp.mu.RUnlock()
+		return tp.status, tp.failures
+	}
+
+	// the scheduled update fails and is retried with growing delays
+	var prev time.Duration
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		requests := repo.RequestCount()
+		require.Eventually(t, func() bool {
+			return clk.waiters() > 0
+		}, 5*time.Second, time.Millisecond)
+		if i == 0 {
+			clk.Advance(time.Hour)
+		} else {
+			clk.Advance(prev)
+		}
+		require.Eventually(t, func() bool {
+			_, failures := status()
+			return failures == i+1
+		}, 5*time.Second, time.Millisecond)
+		require.Greater(t, repo.RequestCount(), requests)
+
+		st, _ := status()
+		require.Error(t, st.Error)
+		require.NotNil(t, st.NextRetry)
+		prev = st.NextRetry.Sub(clk.Now())
+		require.GreaterOrEqual(t, prev, want/2)
+		require.LessOrEqual(t, prev, want)
+	}
+
+	repo.SetError(nil)
+	require.Eventually(t, func() bool {
+		return clk.waiters() > 0
+	}, 5*time.Second, time.Millisecond)
+	clk.Advance(prev)
+	require.Eventually(t, func() bool {
+		st, failures := status()
+		return st.Error == nil && st.NextRetry == nil && failures == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestRetryDelay(t *testing.T) {
+	tp := &TrustProvider{config: SigstoreRootsConfig{
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 10 * time.Second,
+	}}
+	for failures, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		50: 10 * time.Second,
+	} {
+		for range 20 {
+			d := tp.retryDelay(failures)
+			require.GreaterOrEqual(t, d, want/2)
+			require.LessOrEqual(t, d, want)
+		}
+	}
+}
+
+// fakeClock is a clock that only moves forward when advanced by the test.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = timers
+}
+
+// waiters returns the number of pending timers.
+func (c *fakeClock) waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func TestTrustProviderSubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  t.TempDir(),
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	events := make(chan Event, 10)
+	unsubscribe := tp.Subscribe(func(ev Event) {
+		events <- ev
+	})
+
+	repo.SetTarget("signing_config.json", []byte(`{}`))
+	repo.Publish()
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+
+	ev := <-events
+	require.Equal(t, EventUpdated, ev.Type)
+	require.NoError(t, ev.Error)
+	require.Equal(t, int64(1), ev.OldRootVersion)
+	require.Equal(t, int64(1), ev.NewRootVersion)
+	require.Equal(t, map[string]TargetChange{
+		"signing_config.json": {New: digest.FromBytes([]byte(`{}`))},
+	}, ev.ChangedTargets)
+
+	repo.SetError(errors.New("network unreachable"))
+	ch, err = tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+
+	ev = <-events
+	require.Equal(t, EventError, ev.Type)
+	require.ErrorContains(t, ev.Error, "network unreachable")
+
+	unsubscribe()
+	ch, err = tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+	require.Empty(t, events)
+}
+
+func TestTrustProviderMirrors(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  t.TempDir(),
+		NewFetcher: repo.NewFetcher,
+		Mirrors:    []string{"https://mirror.test/tuf", testRepoURL + "/"},
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+
+	require.NoError(t, tp.WaitReady(t.Context()))
+	_, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, testRepoURL+"/", st.Mirror)
+}
+
+func TestNewFetcherTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// the timeout of the caller's client is kept
+	hc := &http.Client{Timeout: 10 * time.Second}
+	f, err := newFetcher(SigstoreRootsConfig{
+		HTTPClient:     hc,
+		RequestTimeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	dt, err := f.DownloadFile(srv.URL, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(dt))
+	require.Equal(t, 10*time.Second, hc.Timeout)
+
+	// RequestTimeout applies to clients without a timeout
+	hc = &http.Client{}
+	f, err = newFetcher(SigstoreRootsConfig{
+		HTTPClient:     hc,
+		RequestTimeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	_, err = f.DownloadFile(srv.URL, 10, 0)
+	require.Error(t, err)
+	require.Zero(t, hc.Timeout)
+}
+
+func TestTrustProviderLock(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	repo.SetTarget("keyring.json", []byte(`{}`))
+	repo.Publish()
+	cachePath := t.TempDir()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:   cachePath,
+		NewFetcher:  repo.NewFetcher,
+		LockTimeout: 100 * time.Millisecond,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	// another process holding a shared lock does not block readers but
+	// blocks updates
+	other := flock.New(filepath.Join(cachePath, ".lock"))
+	require.NoError(t, other.RLock())
+
+	tr, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.False(t, st.LockContended)
+
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+	tp.mu.RLock()
+	updateErr := tp.status.Error
+	tp.mu.RUnlock()
+	require.ErrorIs(t, updateErr, ErrLockTimeout)
+
+	// an exclusive lock does not block readers of the targets verified in
+	// memory
+	require.NoError(t, other.Unlock())
+	require.NoError(t, other.Lock())
+
+	tr, st, err = tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.True(t, st.LockContended)
+
+	// targets that need to be read from the cache wait for the lock until
+	// the timeout
+	_, st, err = tp.Target(t.Context(), "keyring.json")
+	require.ErrorIs(t, err, ErrLockTimeout)
+	require.True(t, st.LockContended)
+
+	// waiting for the lock also stops when the context is canceled
+	ctx, cancel := context.WithCancelCause(t.Context())
+	cancel(errors.WithStack(context.Canceled))
+	_, _, err = tp.Target(ctx, "keyring.json")
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, other.Unlock())
+	dt, st, err := tp.Target(t.Context(), "keyring.json")
+	require.NoError(t, err)
+	require.Equal(t, `{}`, string(dt))
+	require.False(t, st.LockContended)
+}
+
+func TestTrustProviderSlowUpdate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	cachePath := t.TempDir()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:   cachePath,
+		NewFetcher:  repo.NewFetcher,
+		WaitTimeout: 100 * time.Millisecond,
+		LockTimeout: time.Minute,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	_, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	// the lock taken while creating the trust provider does not count as
+	// contended for its first update
+	require.False(t, st.LockContended)
+
+	release := repo.Block()
+	repo.Publish()
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return repo.Blocked() > 0
+	}, 5*time.Second, time.Millisecond)
+
+	// the cache is not locked while the update downloads
+	other := flock.New(filepath.Join(cachePath, ".lock"))
+	locked, err := other.TryLock()
+	require.NoError(t, err)
+	require.True(t, locked)
+	require.NoError(t, other.Unlock())
+
+	start := time.Now()
+	tr, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.NoError(t, st.Error)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	release()
+	<-ch
+	_, st, err = tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, st.Error)
+	require.False(t, st.LockContended)
+	ts, _ := tp.client.Versions()
+	require.Equal(t, int64(2), ts)
+
+	// the committed update is used by a new trust provider while offline
+	repo.SetError(errors.New("network unreachable"))
+	tp2, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  cachePath,
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp2.Close()
+	ts, _ = tp2.client.Versions()
+	require.Equal(t, int64(2), ts)
+}
+
+// stagedRootFetcher reports whether a root was in the cache before the
+// next root version was requested.
+type stagedRootFetcher struct {
+	*tuftest.Repo
+	cacheDir string
+	early    atomic.Bool
+}
+
+func (f *stagedRootFetcher) DownloadFile(urlPath string, maxLength int64, dur time.Duration) ([]byte, error) {
+	if urlPath == tuftest.URL+"/3.root.json" {
+		if _, err := os.Stat(filepath.Join(f.cacheDir, "roots", "2.root.json")); err == nil {
+			f.early.Store(true)
+		}
+	}
+	return f.Repo.DownloadFile(urlPath, maxLength, dur)
+}
+
+func TestTrustProviderStagedUpdate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	cachePath := t.TempDir()
+	// the update is staged in the cache path
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	cacheDir := filepath.Join(cachePath, tuf.URLToPath(tuftest.URL))
+	f := &stagedRootFetcher{Repo: repo, cacheDir: cacheDir}
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath: cachePath,
+		NewFetcher: func() (fetcher.Fetcher, error) {
+			return f, nil
+		},
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	repo.RotateRoot()
+	repo.SetTarget("keyring.json", []byte(`{}`))
+	repo.Publish()
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+	_, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, st.Error)
+	require.Equal(t, int64(2), tp.client.RootVersion())
+	dt, _, err := tp.Target(t.Context(), "keyring.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{}`), dt)
+
+	// the root chain is only written to the cache when the update is
+	// committed under the exclusive lock
+	require.False(t, f.early.Load())
+	_, err = os.Stat(filepath.Join(cacheDir, "roots", "2.root.json"))
+	require.NoError(t, err)
+	// the staging directory is removed
+	entries, err := os.ReadDir(cachePath)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotContains(t, e.Name(), ".update-")
+	}
+}
+
+func TestTrustProviderCommitNewer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	cachePath := t.TempDir()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  cachePath,
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	staged, err := tp.stage()
+	require.NoError(t, err)
+	defer os.RemoveAll(staged)
+	c, err := tp.newClient(staged)
+	require.NoError(t, err)
+	require.NoError(t, c.Refresh())
+
+	// another process commits newer metadata while the update is staged
+	repo.Publish()
+	other, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  cachePath,
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer other.Close()
+	require.NoError(t, other.WaitReady(t.Context()))
+
+	c, committed, err := tp.commit(c, staged)
+	require.NoError(t, err)
+	require.False(t, committed)
+	ts, _ := c.Versions()
+	require.Equal(t, int64(2), ts)
+	ts, err = cachedTimestampVersion(tp.cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), ts)
+}
+
+func TestNewTrustProviderRepository(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	for name, cfg := range map[string]SigstoreRootsConfig{
+		"disk":      {CachePath: t.TempDir()},
+		"in-memory": {InMemory: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.NewFetcher = repo.NewFetcher
+			cfg.repository = &tufrepo.Repository{URL: testRepoURL, Root: repo.Root()}
+			tp, err := NewTrustProvider(cfg)
+			require.NoError(t, err)
+			defer tp.Close()
+
+			require.NoError(t, tp.WaitReady(t.Context()))
+			tr, st, err := tp.TrustedRoot(t.Context())
+			require.NoError(t, err)
+			require.NotNil(t, tr)
+			require.Equal(t, testRepoURL, st.Mirror)
+		})
+	}
+
+	_, err := NewTrustProvider(SigstoreRootsConfig{InMemory: true, repository: &tufrepo.Repository{URL: testRepoURL}})
+	require.ErrorContains(t, err, "root metadata")
+}
+
+func TestTrustProviderInMemory(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+
+	// populate a cache directory that is then only read
+	cachePath := t.TempDir()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  cachePath,
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	require.NoError(t, tp.WaitReady(t.Context()))
+	require.NoError(t, tp.Close())
+	before := dirContents(t, cachePath)
+	// nothing is written to the temporary directory either
+	noTemp := filepath.Join(t.TempDir(), "missing")
+
+	for name, cachePath := range map[string]string{
+		"embedded": "",
+		"seeded":   cachePath,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TMPDIR", noTemp)
+			repo.SetError(nil)
+			tp, err := newTrustProvider(SigstoreRootsConfig{
+				CachePath:  cachePath,
+				NewFetcher: repo.NewFetcher,
+				InMemory:   true,
+			}, testRepository(repo), newFakeClock())
+			require.NoError(t, err)
+			defer tp.Close()
+			require.NoError(t, tp.WaitReady(t.Context()))
+
+			events := make(chan Event, 10)
+			defer tp.Subscribe(func(ev Event) {
+				events <- ev
+			})()
+
+			target := name + ".json"
+			repo.SetTarget(target, []byte(`{}`))
+			repo.Publish()
+			ch, err := tp.startUpdate()
+			require.NoError(t, err)
+			<-ch
+			ev := <-events
+			require.Equal(t, EventUpdated, ev.Type)
+			require.Contains(t, ev.ChangedTargets, target)
+			dt, err := tp.target(t.Context(), tp.client, target)
+			require.NoError(t, err)
+			require.Equal(t, []byte(`{}`), dt)
+
+			// updated state is used while offline
+			repo.SetError(errors.New("network unreachable"))
+			ch, err = tp.startUpdate()
+			require.NoError(t, err)
+			<-ch
+			tr, st, err := tp.TrustedRoot(t.Context())
+			require.NoError(t, err)
+			require.NotNil(t, tr)
+			require.ErrorContains(t, st.Error, "network unreachable")
+			dt, err = tp.target(t.Context(), tp.client, target)
+			require.NoError(t, err)
+			require.Equal(t, []byte(`{}`), dt)
+
+			tp.fetcher.isOnline = false
+			c, err := tp.newClient(tp.config.CachePath)
+			require.NoError(t, err)
+			ts, _ := c.Versions()
+			wantTS, _ := tp.client.Versions()
+			require.Equal(t, wantTS, ts)
+		})
+	}
+
+	require.Equal(t, before, dirContents(t, cachePath))
+}
+
+func TestTrustProviderInMemoryOffline(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	repo.SetError(errors.New("network unreachable"))
+
+	// the seed is loaded through the offline fetcher
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		NewFetcher: repo.NewFetcher,
+		InMemory:   true,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+
+	tr, st, err := tp.TrustedRoot(t.Context())
+	require.NoError(t, err)
+	require.NotNil(t, tr)
+	require.ErrorContains(t, st.Error, "network unreachable")
+}
+
+func TestMemCachePath(t *testing.T) {
+	for rel, want := range map[string]string{
+		"/timestamp.json":       "timestamp.json",
+		"/3.root.json":          "roots/3.root.json",
+		"/12.snapshot.json":     "snapshot.json",
+		"/12.targets.json":      "targets.json",
+		"/snapshot.json":        "snapshot.json",
+		"/targets/abc.foo.json": "",
+		"/":                     "",
+	} {
+		p, ok := memCachePath(rel)
+		require.Equal(t, want != "", ok, rel)
+		require.Equal(t, want, p, rel)
+	}
+}
+
+// dirContents returns the files under dir and their contents.
+func dirContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	require.NoError(t, filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		dt, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[p] = string(dt)
+		return nil
+	}))
+	return files
+}
+
+func TestTrustProviderTarget(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	repo.SetTarget("keyring.json", []byte(`{"v":1}`))
+	repo.Publish()
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  t.TempDir(),
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	dt, st, err := tp.Target(t.Context(), "keyring.json")
+	require.NoError(t, err)
+	require.NoError(t, st.Error)
+	require.Equal(t, `{"v":1}`, string(dt))
+
+	_, _, err = tp.Target(t.Context(), "missing.json")
+	require.ErrorContains(t, err, "missing.json")
+
+	// requested targets are refreshed with the update and served from the
+	// cache while offline
+	repo.SetTarget("keyring.json", []byte(`{"v":2}`))
+	repo.Publish()
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+	repo.SetError(errors.New("network unreachable"))
+
+	requests := repo.RequestCount()
+	dt, _, err = tp.Target(t.Context(), "keyring.json")
+	require.NoError(t, err)
+	require.Equal(t, `{"v":2}`, string(dt))
+	require.Equal(t, requests, repo.RequestCount())
+}
@@ -0,0 +1,322 @@
+package roots
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+	"github.com/theupdateframework/go-tuf/v2/metadata/config"
+	"github.com/theupdateframework/go-tuf/v2/metadata/updater"
+)
+
+// tufClient is a minimal version of tuf.Client from sigstore-go that also
+// gives access to the verified top-level metadata.
+type tufClient struct {
+	mu  sync.Mutex
+	cfg *config.UpdaterConfig
+	up  *updater.Updater
+	// mem caches the targets if the trust provider is in memory
+	mem *memCache
+}
+
+func newTUFClient(opts *tuf.Options, mem *memCache) (*tufClient, error) {
+	cfg, err := newUpdaterConfig(opts, mem)
+	if err != nil {
+		return nil, err
+	}
+	c := &tufClient{cfg: cfg, mem: mem}
+
+	if opts.ForceCache && !opts.DisableLocalCache {
+		// only use the metadata on disk if it is still valid
+		if up, err := newLocalUpdater(cfg); err == nil {
+			c.up = up
+			return c, nil
+		}
+	}
+
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newCachedTUFClient creates a TUF client from the valid metadata in the local
+// cache without contacting the repository.
+func newCachedTUFClient(opts *tuf.Options) (*tufClient, error) {
+	cfg, err := newUpdaterConfig(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	up, err := newLocalUpdater(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &tufClient{cfg: cfg, up: up}, nil
+}
+
+func newUpdaterConfig(opts *tuf.Options, mem *memCache) (*config.UpdaterConfig, error) {
+	cfg, err := config.New(opts.RepositoryBaseURL, opts.Root)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating TUF updater config")
+	}
+	dir := filepath.Join(opts.CachePath, tuf.URLToPath(opts.RepositoryBaseURL))
+	cfg.LocalMetadataDir = dir
+	cfg.LocalTargetsDir = filepath.Join(dir, "targets")
+	cfg.DisableLocalCache = opts.DisableLocalCache
+	cfg.PrefixTargetsWithHash = !opts.DisableConsistentSnapshot
+	cfg.Fetcher = opts.Fetcher
+	if mem != nil {
+		// go-tuf still looks for local metadata with the cache disabled.
+		// os.DevNull is not a directory so nothing is found and all
+		// metadata is loaded through the fetcher from the memory cache.
+		cfg.DisableLocalCache = true
+		cfg.LocalMetadataDir = os.DevNull
+		cfg.LocalTargetsDir = ""
+	}
+	return cfg, nil
+}
+
+func newLocalUpdater(cfg *config.UpdaterConfig) (*updater.Updater, error) {
+	localCfg := *cfg
+	localCfg.UnsafeLocalMode = true
+	up, err := updater.New(&localCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating local TUF updater")
+	}
+	if err := up.Refresh(); err != nil {
+		return nil, errors.Wrap(err, "loading local TUF metadata")
+	}
+	return up, nil
+}
+
+// Refresh replaces the updater with a new one that has done a full TUF update.
+func (c *tufClient) Refresh() error {
+	up, err := updater.New(c.cfg)
+	if err != nil {
+		return errors.Wrap(err, "creating TUF updater")
+	}
+	if err := up.Refresh(); err != nil {
+		return errors.Wrap(err, "refreshing TUF metadata")
+	}
+	c.mu.Lock()
+	c.up = up
+	c.mu.Unlock()
+	return nil
+}
+
+// CachedTarget returns the target from the local cache if it matches the
+// verified targets metadata.
+func (c *tufClient) CachedTarget(name string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ti, err := c.up.GetTargetInfo(name)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "getting info for target %q", name)
+	}
+	return c.cachedTarget(ti)
+}
+
+func (c *tufClient) cachedTarget(ti *metadata.TargetFiles) ([]byte, bool, error) {
+	if c.mem != nil {
+		dt, ok := c.mem.get(path.Join("targets", url.PathEscape(ti.Path)))
+		if !ok || ti.VerifyLengthHashes(dt) != nil {
+			return nil, false, nil
+		}
+		return dt, true, nil
+	}
+	p, dt, err := c.up.FindCachedTarget(ti, "")
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "looking up cached target %q", ti.Path)
+	}
+	return dt, p != "", nil
+}
+
+func (c *tufClient) GetTarget(name string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ti, err := c.up.GetTargetInfo(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting info for target %q", name)
+	}
+	dt, ok, err := c.cachedTarget(ti)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return dt, nil
+	}
+	_, dt, err = c.up.DownloadTarget(ti, "", "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading target %q", name)
+	}
+	if c.mem != nil {
+		c.mem.set(path.Join("targets", url.PathEscape(ti.Path)), dt)
+	}
+	return dt, nil
+}
+
+// DownloadTarget downloads and verifies a target without adding it to the
+// cache, so that no lock on the cache is needed while it is downloaded.
+func (c *tufClient) DownloadTarget(name string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ti, err := c.up.GetTargetInfo(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting info for target %q", name)
+	}
+	// nothing is written with the cache disabled
+	p := os.DevNull
+	if c.mem == nil {
+		// the cache path holds the metadata directory but is not copied
+		// with it, so a partial download is never staged
+		tmp, err := os.CreateTemp(filepath.Dir(c.cfg.LocalMetadataDir), ".target-")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		p = tmp.Name()
+	}
+	_, dt, err := c.up.DownloadTarget(ti, p, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading target %q", name)
+	}
+	return dt, nil
+}
+
+// StoreTarget adds a target returned by DownloadTarget to the cache.
+func (c *tufClient) StoreTarget(name string, dt []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ti, err := c.up.GetTargetInfo(name)
+	if err != nil {
+		return errors.Wrapf(err, "getting info for target %q", name)
+	}
+	if err := ti.VerifyLengthHashes(dt); err != nil {
+		return errors.Wrapf(err, "verifying target %q", name)
+	}
+	if c.mem != nil {
+		c.mem.set(path.Join("targets", url.PathEscape(ti.Path)), dt)
+		return nil
+	}
+	return errors.WithStack(os.WriteFile(filepath.Join(c.cfg.LocalTargetsDir, url.PathEscape(ti.Path)), dt, 0o644))
+}
+
+// Move points the client at dir after the metadata and targets in the
+// directory it was created with have been copied there. It must only be
+// called after Refresh, which creates the updater with the shared config.
+func (c *tufClient) Move(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg.LocalMetadataDir = dir
+	c.cfg.LocalTargetsDir = filepath.Join(dir, "targets")
+}
+
+// Versions returns the versions of the verified timestamp and snapshot
+// metadata.
+func (c *tufClient) Versions() (timestamp, snapshot int64) {
+	c.mu.Lock()
+	tm := c.up.GetTrustedMetadataSet()
+	c.mu.Unlock()
+	if tm.Timestamp != nil {
+		timestamp = tm.Timestamp.Signed.Version
+	}
+	if tm.Snapshot != nil {
+		snapshot = tm.Snapshot.Signed.Version
+	}
+	return timestamp, snapshot
+}
+
+// Expiry returns the expiry times of the verified top-level metadata.
+func (c *tufClient) Expiry() MetadataExpiry {
+	c.mu.Lock()
+	tm := c.up.GetTrustedMetadataSet()
+	c.mu.Unlock()
+
+	var e MetadataExpiry
+	if tm.Root != nil {
+		e.Root = tm.Root.Signed.Expires
+	}
+	if tm.Timestamp != nil {
+		e.Timestamp = tm.Timestamp.Signed.Expires
+	}
+	if tm.Snapshot != nil {
+		e.Snapshot = tm.Snapshot.Signed.Expires
+	}
+	if t, ok := tm.Targets[metadata.TARGETS]; ok {
+		e.Targets = t.Signed.Expires
+	}
+	return e
+}
+
+// RootVersion returns the version of the trusted root metadata.
+func (c *tufClient) RootVersion() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.up.GetTrustedMetadataSet().Root.Signed.Version
+}
+
+// Targets returns the SHA-256 digests of the top-level targets.
+func (c *tufClient) Targets() map[string]digest.Digest {
+	c.mu.Lock()
+	tm := c.up.GetTrustedMetadataSet()
+	c.mu.Unlock()
+
+	targets := map[string]digest.Digest{}
+	t, ok := tm.Targets[metadata.TARGETS]
+	if !ok {
+		return targets
+	}
+	for name, tf := range t.Signed.Targets {
+		if h, ok := tf.Hashes["sha256"]; ok {
+			targets[name] = digest.NewDigestFromBytes(digest.SHA256, h)
+		}
+	}
+	return targets
+}
+
+// MetadataExpiry contains the expiry times of the top-level TUF metadata.
+type MetadataExpiry struct {
+	Root      time.Time `json:"root"`
+	Timestamp time.Time `json:"timestamp"`
+	Snapshot  time.Time `json:"snapshot"`
+	Targets   time.Time `json:"targets"`
+}
+
+// Earliest returns the role and time of the metadata that expires first.
+// Metadata without an expiry time is skipped. The time is zero if none has
+// one.
+func (e MetadataExpiry) Earliest() (string, time.Time) {
+	var (
+		role string
+		t    time.Time
+	)
+	for _, r := range []struct {
+		role string
+		t    time.Time
+	}{
+		{metadata.ROOT, e.Root},
+		{metadata.TIMESTAMP, e.Timestamp},
+		{metadata.SNAPSHOT, e.Snapshot},
+		{metadata.TARGETS, e.Targets},
+	} {
+		if r.t.IsZero() {
+			continue
+		}
+		if t.IsZero() || r.t.Before(t) {
+			role, t = r.role, r.t
+		}
+	}
+	return role, t
+}
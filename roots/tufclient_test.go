@@ -0,0 +1,115 @@
+package roots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+	"go.uber.org/goleak"
+)
+
+func TestMetadataExpiryEarliest(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		in       MetadataExpiry
+		wantRole string
+		want     time.Time
+	}{
+		{
+			name: "zero",
+		},
+		{
+			name:     "root-zero",
+			in:       MetadataExpiry{Timestamp: now.Add(2 * time.Hour), Targets: now.Add(time.Hour)},
+			wantRole: metadata.TARGETS,
+			want:     now.Add(time.Hour),
+		},
+		{
+			name: "all",
+			in: MetadataExpiry{
+				Root:      now.Add(4 * time.Hour),
+				Timestamp: now.Add(time.Hour),
+				Snapshot:  now.Add(2 * time.Hour),
+				Targets:   now.Add(3 * time.Hour),
+			},
+			wantRole: metadata.TIMESTAMP,
+			want:     now.Add(time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, ts := tt.in.Earliest()
+			require.Equal(t, tt.wantRole, role)
+			require.True(t, tt.want.Equal(ts), "got %s, want %s", ts, tt.want)
+		})
+	}
+}
+
+func TestTUFClientMetadata(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	tp, err := newTrustProvider(SigstoreRootsConfig{
+		CachePath:  t.TempDir(),
+		NewFetcher: repo.NewFetcher,
+	}, testRepository(repo), newFakeClock())
+	require.NoError(t, err)
+	defer tp.Close()
+	require.NoError(t, tp.WaitReady(t.Context()))
+
+	expires := repo.Expires()
+	require.Equal(t, MetadataExpiry{
+		Root:      expires,
+		Timestamp: expires,
+		Snapshot:  expires,
+		Targets:   expires,
+	}, tp.client.Expiry())
+	require.Equal(t, int64(1), tp.client.RootVersion())
+	timestamp, snapshot := tp.client.Versions()
+	require.Equal(t, int64(1), timestamp)
+	require.Equal(t, int64(1), snapshot)
+
+	repo.Publish()
+	ch, err := tp.startUpdate()
+	require.NoError(t, err)
+	<-ch
+
+	tp.mu.RLock()
+	c := tp.client
+	tp.mu.RUnlock()
+	require.Equal(t, int64(1), c.RootVersion())
+	timestamp, snapshot = c.Versions()
+	require.Equal(t, int64(2), timestamp)
+	require.Equal(t, int64(2), snapshot)
+}
+
+func TestTrustProviderExpiresSoon(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	repo := newTestRepo(t)
+	for name, tc := range map[string]struct {
+		period time.Duration
+		want   bool
+	}{
+		"default":         {want: false},
+		"within-warning":  {period: 400 * 24 * time.Hour, want: true},
+		"outside-warning": {period: 300 * 24 * time.Hour, want: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tp, err := newTrustProvider(SigstoreRootsConfig{
+				CachePath:           t.TempDir(),
+				NewFetcher:          repo.NewFetcher,
+				ExpiryWarningPeriod: tc.period,
+			}, testRepository(repo), newFakeClock())
+			require.NoError(t, err)
+			defer tp.Close()
+
+			_, st, err := tp.TrustedRoot(t.Context())
+			require.NoError(t, err)
+			require.NotNil(t, st.Expiry)
+			require.Equal(t, tc.want, st.ExpiresSoon)
+		})
+	}
+}
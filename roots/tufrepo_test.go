@@ -0,0 +1,25 @@
+package roots
+
+import (
+	"testing"
+
+	"github.com/moby/policy-helpers/internal/tuftest"
+	"github.com/stretchr/testify/require"
+)
+
+const testRepoURL = tuftest.URL
+
+// newTestRepo returns a test TUF repository with the embedded trusted root.
+func newTestRepo(t *testing.T) *tuftest.Repo {
+	trustedRoot, err := EmbeddedTUF.ReadFile("tuf-root/targets/" + trustedRootFilename)
+	require.NoError(t, err)
+	return tuftest.NewRepo(t, map[string][]byte{trustedRootFilename: trustedRoot})
+}
+
+func testRepository(r *tuftest.Repo) repository {
+	return repository{
+		baseURL: tuftest.URL,
+		root:    r.Root(),
+		seed:    r.Seed(),
+	}
+}
@@ -0,0 +1,105 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/types"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	PredicateTypeSPDX      = "https://spdx.dev/Document"
+	PredicateTypeCycloneDX = "https://cyclonedx.org/bom"
+)
+
+// SBOM is an SBOM document read from a verified attestation manifest.
+type SBOM struct {
+	PredicateType string
+	// Layer is the attestation manifest layer the document was read from.
+	// Its digest has been checked against the verified attestation manifest.
+	Layer         ocispecs.Descriptor
+	SignatureInfo *types.SignatureInfo
+
+	data []byte
+}
+
+// Reader returns a reader for the SBOM document.
+func (s *SBOM) Reader() io.Reader {
+	return bytes.NewReader(s.data)
+}
+
+// IsSBOMPredicateType reports whether the predicate type is a supported SBOM
+// format.
+func IsSBOMPredicateType(v string) bool {
+	return v == PredicateTypeSPDX || v == PredicateTypeCycloneDX || strings.HasPrefix(v, PredicateTypeCycloneDX+"/")
+}
+
+// VerifyImageSBOMs verifies the signature chain of the image manifest for
+// platform and returns the SPDX and CycloneDX documents that the verified
+// attestations contain. For Docker Hardened Images every SBOM is in its own
+// attestation that is verified separately.
+func (v *Verifier) VerifyImageSBOMs(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform, opt ...ImageVerifyOpt) ([]*SBOM, error) {
+	opts := &ImageVerifyOpts{}
+	for _, o := range opt {
+		o(opts)
+	}
+	opts.slsaNotRequired = true
+
+	isDHI, err := image.IsDHIImage(ctx, provider, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading image index %s", desc.Digest)
+	}
+
+	var sboms []*SBOM
+	if isDHI {
+		atts, err := v.VerifyDHIAttestations(ctx, provider, desc, platform, opt...)
+		if err != nil {
+			return nil, err
+		}
+		for _, pt := range slices.Sorted(maps.Keys(atts)) {
+			if !IsSBOMPredicateType(pt) {
+				continue
+			}
+			for _, att := range atts[pt] {
+				sboms = append(sboms, &SBOM{
+					PredicateType: pt,
+					Layer:         att.Layer,
+					SignatureInfo: att.SignatureInfo,
+					data:          att.Predicate,
+				})
+			}
+		}
+	} else {
+		sc, err := image.ResolveSignatureChain(ctx, provider, desc, platform)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving signature chain for image %s", desc.Digest)
+		}
+		opts.statementTypes = IsSBOMPredicateType
+		vc, err := v.verifySignatureChain(ctx, sc, desc.Digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range vc.statements {
+			if !IsSBOMPredicateType(stmt.PredicateType) {
+				continue
+			}
+			sboms = append(sboms, &SBOM{
+				PredicateType: stmt.PredicateType,
+				Layer:         stmt.layer,
+				SignatureInfo: vc.SignatureInfo,
+				data:          stmt.Predicate,
+			})
+		}
+	}
+	if len(sboms) == 0 {
+		return nil, errors.Errorf("no SBOM attestations found for image %s", desc.Digest)
+	}
+	return sboms, nil
+}
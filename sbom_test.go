@@ -0,0 +1,92 @@
+package verifier
+
+import (
+	"io"
+	"testing"
+
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/roots"
+	"github.com/moby/policy-helpers/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyImageSBOMsDHI(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	img := newTestDHIImage(t, key)
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+	spdx := img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{"spdxVersion": "SPDX-2.3"})
+	img.attest(PredicateTypeSPDX, spdx)
+
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	sboms, err := v.VerifyImageSBOMs(t.Context(), img.store, img.index, &testPlatform)
+	require.NoError(t, err)
+	require.Len(t, sboms, 1)
+	require.Equal(t, PredicateTypeSPDX, sboms[0].PredicateType)
+	require.Equal(t, spdx.Digest, sboms[0].Layer.Digest)
+	require.True(t, sboms[0].SignatureInfo.IsDHI)
+	dt, err := io.ReadAll(sboms[0].Reader())
+	require.NoError(t, err)
+	require.JSONEq(t, `{"spdxVersion":"SPDX-2.3"}`, string(dt))
+	// the statement is read once while verifying
+	require.Equal(t, 1, img.store.readCount(spdx.Digest))
+}
+
+func TestVerifyImageSBOMs(t *testing.T) {
+	sigstore := newTestSigstore(t)
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, map[string][]byte{
+		"trusted_root.json": sigstore.trustedRoot(),
+	})
+	defer tp.Close()
+
+	v, err := NewVerifier(Config{TrustProvider: tp})
+	require.NoError(t, err)
+	defer v.Close()
+
+	img := newTestImage(t, sigstore)
+	spdx := img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{"spdxVersion": "SPDX-2.3"})
+	cdx := img.statement(PredicateTypeCycloneDX, img.manifest.Digest, map[string]any{"bomFormat": "CycloneDX"})
+	img.attest(img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}), spdx, cdx)
+
+	sboms, err := v.VerifyImageSBOMs(t.Context(), img.store, img.index, &testPlatform)
+	require.NoError(t, err)
+	require.Len(t, sboms, 2)
+	require.Equal(t, PredicateTypeSPDX, sboms[0].PredicateType)
+	require.Equal(t, spdx.Digest, sboms[0].Layer.Digest)
+	require.Equal(t, PredicateTypeCycloneDX, sboms[1].PredicateType)
+	require.Equal(t, cdx.Digest, sboms[1].Layer.Digest)
+
+	si := sboms[0].SignatureInfo
+	require.False(t, si.IsDHI)
+	require.Equal(t, types.SignatureBundleV03, si.SignatureType)
+	require.True(t, si.TransparencyLog)
+	require.NotNil(t, si.Signer)
+	require.Equal(t, testSignerIdentity, si.Signer.SubjectAlternativeName)
+	require.Equal(t, testSignerIssuer, si.Signer.Issuer)
+
+	dt, err := io.ReadAll(sboms[1].Reader())
+	require.NoError(t, err)
+	require.JSONEq(t, `{"bomFormat":"CycloneDX"}`, string(dt))
+	require.Equal(t, 1, img.store.readCount(spdx.Digest))
+
+	t.Run("no-sbom", func(t *testing.T) {
+		img := newTestImage(t, sigstore)
+		img.attest(img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+
+		_, err := v.VerifyImageSBOMs(t.Context(), img.store, img.index, &testPlatform)
+		require.ErrorContains(t, err, "no SBOM attestations found")
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		img := newTestImage(t, newTestSigstore(t))
+		img.attest(img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{}))
+
+		_, err := v.VerifyImageSBOMs(t.Context(), img.store, img.index, &testPlatform)
+		require.ErrorContains(t, err, "verifying bundle")
+	})
+}
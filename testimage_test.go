@@ -0,0 +1,357 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/remotes"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/roots/dhi"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore is an in-memory image.ReferrersProvider.
+type testStore struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	referrers map[digest.Digest][]ocispecs.Descriptor
+	reads     map[digest.Digest]int
+}
+
+func newTestStore(t *testing.T) *testStore {
+	return &testStore{
+		t:         t,
+		blobs:     map[digest.Digest][]byte{},
+		referrers: map[digest.Digest][]ocispecs.Descriptor{},
+		reads:     map[digest.Digest]int{},
+	}
+}
+
+// add stores dt and returns its descriptor.
+func (s *testStore) add(mediaType string, dt []byte) ocispecs.Descriptor {
+	desc := ocispecs.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	s.mu.Lock()
+	s.blobs[desc.Digest] = dt
+	s.mu.Unlock()
+	return desc
+}
+
+// addJSON stores v marshaled to JSON and returns its descriptor.
+func (s *testStore) addJSON(mediaType string, v any) ocispecs.Descriptor {
+	s.t.Helper()
+	dt, err := json.Marshal(v)
+	require.NoError(s.t, err)
+	return s.add(mediaType, dt)
+}
+
+// addReferrer registers desc as a referrer of subject.
+func (s *testStore) addReferrer(subject digest.Digest, desc ocispecs.Descriptor) {
+	s.mu.Lock()
+	s.referrers[subject] = append(s.referrers[subject], desc)
+	s.mu.Unlock()
+}
+
+// replace serves dt for dgst without updating the digest.
+func (s *testStore) replace(dgst digest.Digest, dt []byte) {
+	s.mu.Lock()
+	s.blobs[dgst] = dt
+	s.mu.Unlock()
+}
+
+// readCount returns how many times dgst has been read.
+func (s *testStore) readCount(dgst digest.Digest) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads[dgst]
+}
+
+func (s *testStore) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	s.mu.Lock()
+	dt, ok := s.blobs[desc.Digest]
+	s.reads[desc.Digest]++
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.Wrapf(cerrdefs.ErrNotFound, "blob %s", desc.Digest)
+	}
+	return &bytesReaderAt{Reader: bytes.NewReader(dt)}, nil
+}
+
+func (s *testStore) FetchReferrers(ctx context.Context, dgst digest.Digest, opts ...remotes.FetchReferrersOpt) ([]ocispecs.Descriptor, error) {
+	var cfg remotes.FetchReferrersConfig
+	for _, o := range opts {
+		if err := o(ctx, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ocispecs.Descriptor
+	for _, r := range s.referrers[dgst] {
+		if len(cfg.ArtifactTypes) > 0 && !slices.Contains(cfg.ArtifactTypes, r.ArtifactType) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+type bytesReaderAt struct {
+	*bytes.Reader
+}
+
+func (r *bytesReaderAt) Close() error {
+	return nil
+}
+
+var testPlatform = ocispecs.Platform{OS: "linux", Architecture: "amd64"}
+
+// testDHIKey is a key that test DHI images are signed with.
+type testDHIKey struct {
+	t    *testing.T
+	priv *ecdsa.PrivateKey
+}
+
+func newTestDHIKey(t *testing.T) *testDHIKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &testDHIKey{t: t, priv: priv}
+}
+
+// key returns the public key for a keyring.
+func (k *testDHIKey) key() *dhi.Key {
+	k.t.Helper()
+	pem, err := cryptoutils.MarshalPublicKeyToPEM(k.priv.Public())
+	require.NoError(k.t, err)
+	return &dhi.Key{PublicKey: string(pem)}
+}
+
+func (k *testDHIKey) sign(dt []byte) string {
+	k.t.Helper()
+	sum := sha256.Sum256(dt)
+	sig, err := ecdsa.SignASN1(rand.Reader, k.priv, sum[:])
+	require.NoError(k.t, err)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// writeTestKeyring writes a keyring with keys to a file and returns its path.
+func writeTestKeyring(t *testing.T, keys ...*dhi.Key) string {
+	dt, err := json.Marshal(dhi.Keyring{Keys: keys})
+	require.NoError(t, err)
+	p := filepath.Join(t.TempDir(), "keyring.json")
+	require.NoError(t, os.WriteFile(p, dt, 0o600))
+	return p
+}
+
+// testDHIImage is a single platform DHI image with attestations signed like
+// the ones published for Docker Hardened Images.
+type testDHIImage struct {
+	t     *testing.T
+	store *testStore
+	key   *testDHIKey
+	name  string
+
+	index    ocispecs.Descriptor
+	manifest ocispecs.Descriptor
+}
+
+func newTestDHIImage(t *testing.T, key *testDHIKey) *testDHIImage {
+	return newNamedTestDHIImage(t, key, "test")
+}
+
+// newNamedTestDHIImage returns a DHI image for dhi/name, so that images with
+// different names have different digests.
+func newNamedTestDHIImage(t *testing.T, key *testDHIKey, name string) *testDHIImage {
+	store := newTestStore(t)
+	config := store.addJSON(ocispecs.MediaTypeImageConfig, ocispecs.Image{Platform: testPlatform})
+	manifest := store.addJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispecs.Descriptor{},
+	})
+	manifest.Platform = &testPlatform
+	manifest.Annotations = map[string]string{"com.docker.dhi.build.id": "1"}
+	index := store.addJSON(ocispecs.MediaTypeImageIndex, ocispecs.Index{
+		MediaType:   ocispecs.MediaTypeImageIndex,
+		Manifests:   []ocispecs.Descriptor{manifest},
+		Annotations: map[string]string{"org.opencontainers.image.title": "dhi/" + name},
+	})
+	return &testDHIImage{t: t, store: store, key: key, name: name, index: index, manifest: manifest}
+}
+
+// statement adds an in-toto statement layer about subject.
+func (s *testStore) statement(predicateType string, subject digest.Digest, predicate any) ocispecs.Descriptor {
+	s.t.Helper()
+	desc := s.addJSON(mediaTypeInTotoStatement, map[string]any{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": predicateType,
+		"subject": []map[string]any{
+			{"name": "test", "digest": map[string]string{subject.Algorithm().String(): subject.Encoded()}},
+		},
+		"predicate": predicate,
+	})
+	desc.Annotations = map[string]string{image.AnnotationInTotoPredicateType: predicateType}
+	return desc
+}
+
+// statement adds an in-toto statement layer about subject.
+func (img *testDHIImage) statement(predicateType string, subject digest.Digest, predicate any) ocispecs.Descriptor {
+	img.t.Helper()
+	return img.store.statement(predicateType, subject, predicate)
+}
+
+// dsseStatement adds an in-toto statement about subject wrapped in a DSSE
+// envelope.
+func (img *testDHIImage) dsseStatement(predicateType string, subject digest.Digest, predicate any) ocispecs.Descriptor {
+	img.t.Helper()
+	stmt := img.statement(predicateType, subject, predicate)
+	payload, err := image.ReadBlob(context.TODO(), img.store, stmt)
+	require.NoError(img.t, err)
+	desc := img.store.addJSON(mediaTypeDSSEEnvelope, map[string]any{
+		"payloadType": mediaTypeInTotoStatement,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []any{},
+	})
+	desc.Annotations = stmt.Annotations
+	return desc
+}
+
+// attest adds a signed attestation manifest with layers for predicateType.
+func (img *testDHIImage) attest(predicateType string, layers ...ocispecs.Descriptor) ocispecs.Descriptor {
+	img.t.Helper()
+	subject := img.manifest
+	subject.Platform = nil
+	subject.Annotations = nil
+	att := img.store.addJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: image.ArtifactTypeInTotoJSON,
+		Config:       ocispecs.DescriptorEmptyJSON,
+		Layers:       layers,
+		Subject:      &subject,
+	})
+	att.ArtifactType = image.ArtifactTypeInTotoJSON
+	att.Annotations = map[string]string{image.AnnotationInTotoPredicateType: predicateType}
+	img.store.addReferrer(img.manifest.Digest, att)
+
+	payload, err := json.Marshal(map[string]any{
+		"critical": map[string]any{
+			"identity": map[string]any{"docker-reference": "docker.io/dhi/test"},
+			"image":    map[string]any{"docker-manifest-digest": att.Digest.String()},
+			"type":     "cosign container image signature",
+		},
+	})
+	require.NoError(img.t, err)
+	layer := img.store.add(image.MediaTypeCosignSimpleSigning, payload)
+	layer.Annotations = map[string]string{annotationSignature: img.key.sign(payload)}
+	attSubject := att
+	attSubject.ArtifactType = ""
+	attSubject.Annotations = nil
+	sig := img.store.addJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: image.ArtifactTypeCosignSignature,
+		Config:       ocispecs.DescriptorEmptyJSON,
+		Layers:       []ocispecs.Descriptor{layer},
+		Subject:      &attSubject,
+	})
+	sig.ArtifactType = image.ArtifactTypeCosignSignature
+	img.store.addReferrer(att.Digest, sig)
+	return att
+}
+
+// testImage is a single platform image with its attestation manifest in the
+// index, signed with a Sigstore bundle like images built with BuildKit.
+type testImage struct {
+	t        *testing.T
+	store    *testStore
+	sigstore *testSigstore
+
+	index    ocispecs.Descriptor
+	manifest ocispecs.Descriptor
+}
+
+func newTestImage(t *testing.T, sigstore *testSigstore) *testImage {
+	store := newTestStore(t)
+	config := store.addJSON(ocispecs.MediaTypeImageConfig, ocispecs.Image{Platform: testPlatform})
+	manifest := store.addJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispecs.Descriptor{},
+	})
+	manifest.Platform = &testPlatform
+	img := &testImage{t: t, store: store, sigstore: sigstore, manifest: manifest}
+	img.index = img.addIndex()
+	return img
+}
+
+func (img *testImage) addIndex(manifests ...ocispecs.Descriptor) ocispecs.Descriptor {
+	img.t.Helper()
+	return img.store.addJSON(ocispecs.MediaTypeImageIndex, ocispecs.Index{
+		MediaType: ocispecs.MediaTypeImageIndex,
+		Manifests: append([]ocispecs.Descriptor{img.manifest}, manifests...),
+	})
+}
+
+// statement adds an in-toto statement layer about subject.
+func (img *testImage) statement(predicateType string, subject digest.Digest, predicate any) ocispecs.Descriptor {
+	img.t.Helper()
+	return img.store.statement(predicateType, subject, predicate)
+}
+
+// attest replaces the index with one that has an attestation manifest with
+// layers, and adds the bundle signing it as a referrer.
+func (img *testImage) attest(layers ...ocispecs.Descriptor) ocispecs.Descriptor {
+	img.t.Helper()
+	subject := img.manifest
+	subject.Platform = nil
+	dt, err := json.Marshal(ocispecs.Manifest{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Config:    ocispecs.DescriptorEmptyJSON,
+		Layers:    layers,
+		Subject:   &subject,
+	})
+	require.NoError(img.t, err)
+	att := img.store.add(ocispecs.MediaTypeImageManifest, dt)
+	att.Platform = &ocispecs.Platform{OS: "unknown", Architecture: "unknown"}
+	att.Annotations = map[string]string{
+		image.AnnotationDockerReferenceType:   image.AttestationManifestType,
+		image.AnnotationDockerReferenceDigest: img.manifest.Digest.String(),
+	}
+	img.index = img.addIndex(att)
+
+	layer := img.store.add(image.ArtifactTypeSigstoreBundle, img.sigstore.sign(dt))
+	attSubject := att
+	attSubject.Platform = nil
+	attSubject.Annotations = nil
+	sig := img.store.addJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: image.ArtifactTypeSigstoreBundle,
+		Config:       ocispecs.DescriptorEmptyJSON,
+		Layers:       []ocispecs.Descriptor{layer},
+		Subject:      &attSubject,
+	})
+	sig.ArtifactType = image.ArtifactTypeSigstoreBundle
+	img.store.addReferrer(att.Digest, sig)
+	return att
+}
@@ -0,0 +1,280 @@
+package verifier
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/require"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+const (
+	testSignerIdentity = "https://github.com/example/app/.github/workflows/build.yml@refs/heads/main"
+	testSignerIssuer   = "https://token.actions.githubusercontent.com"
+)
+
+// testSigstore is a Sigstore instance with its own Fulcio CA, CT log and
+// Rekor log that signs bundles like the public good instance.
+type testSigstore struct {
+	t     *testing.T
+	start time.Time
+
+	caKey    *ecdsa.PrivateKey
+	ca       *x509.Certificate
+	ctKey    *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newTestSigstore(t *testing.T) *testSigstore {
+	s := &testSigstore{
+		t:        t,
+		start:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		caKey:    newTestECDSAKey(t),
+		ctKey:    newTestECDSAKey(t),
+		rekorKey: newTestECDSAKey(t),
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio.test", Organization: []string{"test"}},
+		NotBefore:             s.start,
+		NotAfter:              s.start.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, s.caKey.Public(), s.caKey)
+	require.NoError(t, err)
+	s.ca, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return s
+}
+
+func newTestECDSAKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// logID returns the ID of a log with key.
+func (s *testSigstore) logID(key *ecdsa.PrivateKey) []byte {
+	s.t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(s.t, err)
+	sum := sha256.Sum256(der)
+	return sum[:]
+}
+
+// trustedRoot returns the trusted_root.json target for the instance.
+func (s *testSigstore) trustedRoot() []byte {
+	s.t.Helper()
+	tlog := func(url string, key *ecdsa.PrivateKey) map[string]*root.TransparencyLog {
+		id := s.logID(key)
+		return map[string]*root.TransparencyLog{hex.EncodeToString(id): {
+			BaseURL:             url,
+			ID:                  id,
+			ValidityPeriodStart: s.start,
+			HashFunc:            crypto.SHA256,
+			PublicKey:           key.Public(),
+			SignatureHashFunc:   crypto.SHA256,
+		}}
+	}
+	tr, err := root.NewTrustedRoot(root.TrustedRootMediaType01,
+		[]root.CertificateAuthority{&root.FulcioCertificateAuthority{
+			Root:                s.ca,
+			ValidityPeriodStart: s.start,
+			URI:                 "https://fulcio.test",
+		}},
+		tlog("https://ctfe.test", s.ctKey),
+		nil,
+		tlog("https://rekor.test", s.rekorKey),
+	)
+	require.NoError(s.t, err)
+	dt, err := tr.MarshalJSON()
+	require.NoError(s.t, err)
+	return dt
+}
+
+// sign returns a bundle with a signature over dt by a short-lived certificate
+// for testSignerIdentity.
+func (s *testSigstore) sign(dt []byte) []byte {
+	s.t.Helper()
+	key := newTestECDSAKey(s.t)
+	now := time.Now()
+	cert := s.certificate(key, now)
+	sum := sha256.Sum256(dt)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	require.NoError(s.t, err)
+
+	b := &bundle.Bundle{Bundle: &protobundle.Bundle{
+		MediaType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+		VerificationMaterial: &protobundle.VerificationMaterial{
+			Content: &protobundle.VerificationMaterial_Certificate{
+				Certificate: &protocommon.X509Certificate{RawBytes: cert.Raw},
+			},
+			TlogEntries: []*protorekor.TransparencyLogEntry{s.logEntry(cert, sig, sum[:], now)},
+		},
+		Content: &protobundle.Bundle_MessageSignature{
+			MessageSignature: &protocommon.MessageSignature{
+				MessageDigest: &protocommon.HashOutput{
+					Algorithm: protocommon.HashAlgorithm_SHA2_256,
+					Digest:    sum[:],
+				},
+				Signature: sig,
+			},
+		},
+	}}
+	out, err := b.MarshalJSON()
+	require.NoError(s.t, err)
+	return out
+}
+
+// certificate issues a certificate for key with an SCT embedded like Fulcio
+// does: the CT log signs the precertificate, which has a poison extension in
+// place of the SCT list.
+func (s *testSigstore) certificate(key *ecdsa.PrivateKey, now time.Time) *x509.Certificate {
+	s.t.Helper()
+	san, err := url.Parse(testSignerIdentity)
+	require.NoError(s.t, err)
+	issuer, err := asn1.MarshalWithParams(testSignerIssuer, "utf8")
+	require.NoError(s.t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{san},
+		ExtraExtensions: []pkix.Extension{
+			{Id: certificate.OIDIssuerV2, Value: issuer},
+			{Id: asn1.ObjectIdentifier(ctx509.OIDExtensionCTPoison), Critical: true, Value: asn1.NullBytes},
+		},
+	}
+	pre, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, key.Public(), s.caKey)
+	require.NoError(s.t, err)
+	preCert, err := x509.ParseCertificate(pre)
+	require.NoError(s.t, err)
+	tbs, err := ctx509.RemoveCTPoison(preCert.RawTBSCertificate)
+	require.NoError(s.t, err)
+
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  uint64(now.UnixMilli()),
+	}
+	copy(sct.LogID.KeyID[:], s.logID(s.ctKey))
+	input, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			EntryType: ct.PrecertLogEntryType,
+			Timestamp: sct.Timestamp,
+			PrecertEntry: &ct.PreCert{
+				IssuerKeyHash:  sha256.Sum256(s.ca.RawSubjectPublicKeyInfo),
+				TBSCertificate: tbs,
+			},
+		},
+	}})
+	require.NoError(s.t, err)
+	sum := sha256.Sum256(input)
+	sctSig, err := ecdsa.SignASN1(rand.Reader, s.ctKey, sum[:])
+	require.NoError(s.t, err)
+	sct.Signature = ct.DigitallySigned{
+		Algorithm: cttls.SignatureAndHashAlgorithm{Hash: cttls.SHA256, Signature: cttls.ECDSA},
+		Signature: sctSig,
+	}
+	list, err := x509util.MarshalSCTsIntoSCTList([]*ct.SignedCertificateTimestamp{&sct})
+	require.NoError(s.t, err)
+	listBytes, err := cttls.Marshal(*list)
+	require.NoError(s.t, err)
+	sctExt, err := asn1.Marshal(listBytes)
+	require.NoError(s.t, err)
+
+	tmpl.ExtraExtensions[1] = pkix.Extension{Id: asn1.ObjectIdentifier(ctx509.OIDExtensionCTSCT), Value: sctExt}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, key.Public(), s.caKey)
+	require.NoError(s.t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(s.t, err)
+	return cert
+}
+
+// logEntry returns a hashedrekord entry for sig as the only entry of the
+// Rekor log, with its inclusion promise and proof.
+func (s *testSigstore) logEntry(cert *x509.Certificate, sig, sum []byte, now time.Time) *protorekor.TransparencyLogEntry {
+	s.t.Helper()
+	certPEM, err := cryptoutils.MarshalCertificateToPEM(cert)
+	require.NoError(s.t, err)
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data": map[string]any{
+				"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(sum)},
+			},
+			"signature": map[string]any{
+				"content":   base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString(certPEM)},
+			},
+		},
+	})
+	require.NoError(s.t, err)
+
+	logID := s.logID(s.rekorKey)
+	// keys are sorted and nothing needs escaping, so this is the canonical
+	// JSON that the SET signs
+	payload, err := json.Marshal(map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": now.Unix(),
+		"logID":          hex.EncodeToString(logID),
+		"logIndex":       0,
+	})
+	require.NoError(s.t, err)
+	payloadSum := sha256.Sum256(payload)
+	set, err := ecdsa.SignASN1(rand.Reader, s.rekorKey, payloadSum[:])
+	require.NoError(s.t, err)
+
+	signer, err := signature.LoadECDSASignerVerifier(s.rekorKey, crypto.SHA256)
+	require.NoError(s.t, err)
+	rootHash := rfc6962.DefaultHasher.HashLeaf(body)
+	checkpoint, err := util.CreateAndSignCheckpoint(s.t.Context(), "rekor.test", 1, 1, rootHash, signer)
+	require.NoError(s.t, err)
+
+	return &protorekor.TransparencyLogEntry{
+		LogIndex:         0,
+		LogId:            &protocommon.LogId{KeyId: logID},
+		KindVersion:      &protorekor.KindVersion{Kind: "hashedrekord", Version: "0.0.1"},
+		IntegratedTime:   now.Unix(),
+		InclusionPromise: &protorekor.InclusionPromise{SignedEntryTimestamp: set},
+		InclusionProof: &protorekor.InclusionProof{
+			LogIndex:   0,
+			RootHash:   rootHash,
+			TreeSize:   1,
+			Checkpoint: &protorekor.Checkpoint{Envelope: string(checkpoint)},
+		},
+		CanonicalizedBody: body,
+	}
+}
@@ -0,0 +1,161 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/pkg/errors"
+)
+
+// Provenance is SLSA provenance normalized across predicate versions so that
+// policies can check it without branching on the version.
+type Provenance struct {
+	PredicateType string `json:"predicateType"`
+	BuilderID     string `json:"builderId,omitempty"`
+	BuildType     string `json:"buildType,omitempty"`
+	// Source is the build configuration the build was started from, if the
+	// provenance records one.
+	Source *ProvenanceSource `json:"source,omitempty"`
+	// Parameters are the invocation parameters in SLSA v0.2 and the external
+	// parameters in SLSA v1.
+	Parameters any `json:"parameters,omitempty"`
+	// InternalParameters are the invocation environment in SLSA v0.2 and the
+	// internal parameters in SLSA v1.
+	InternalParameters any `json:"internalParameters,omitempty"`
+	// Materials are the materials in SLSA v0.2 and the resolved dependencies
+	// in SLSA v1.
+	Materials []ProvenanceMaterial `json:"materials,omitempty"`
+	Metadata  *ProvenanceMetadata  `json:"metadata,omitempty"`
+	// Predicate is the predicate the provenance was parsed from, for reading
+	// builder specific fields.
+	Predicate json.RawMessage `json:"-"`
+}
+
+type ProvenanceSource struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+type ProvenanceMaterial struct {
+	URI    string            `json:"uri,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type ProvenanceMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// ParseProvenance parses a SLSA v0.2 or v1 provenance predicate.
+func ParseProvenance(predicateType string, predicate []byte) (*Provenance, error) {
+	switch predicateType {
+	case slsa02.PredicateSLSAProvenance:
+		var p slsa02.ProvenancePredicate
+		if err := json.Unmarshal(predicate, &p); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling SLSA v0.2 provenance")
+		}
+		prv := ProvenanceFromSLSA02(&p)
+		prv.Predicate = predicate
+		return prv, nil
+	case slsa1.PredicateSLSAProvenance:
+		var p slsa1.ProvenancePredicate
+		if err := json.Unmarshal(predicate, &p); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling SLSA v1 provenance")
+		}
+		prv := ProvenanceFromSLSA1(&p)
+		prv.Predicate = predicate
+		return prv, nil
+	default:
+		return nil, errors.Errorf("unexpected predicate type %q, expecting SLSA provenance", predicateType)
+	}
+}
+
+// ProvenanceFromSLSA02 converts a SLSA v0.2 provenance predicate.
+func ProvenanceFromSLSA02(p *slsa02.ProvenancePredicate) *Provenance {
+	prv := &Provenance{
+		PredicateType:      slsa02.PredicateSLSAProvenance,
+		BuilderID:          p.Builder.ID,
+		BuildType:          p.BuildType,
+		Parameters:         p.Invocation.Parameters,
+		InternalParameters: p.Invocation.Environment,
+	}
+	if cs := p.Invocation.ConfigSource; cs.URI != "" {
+		prv.Source = &ProvenanceSource{
+			URI:        cs.URI,
+			Digest:     cs.Digest,
+			EntryPoint: cs.EntryPoint,
+		}
+	}
+	for _, m := range p.Materials {
+		prv.Materials = append(prv.Materials, ProvenanceMaterial{
+			URI:    m.URI,
+			Digest: m.Digest,
+		})
+	}
+	if md := p.Metadata; md != nil {
+		prv.Metadata = &ProvenanceMetadata{
+			InvocationID: md.BuildInvocationID,
+			StartedOn:    md.BuildStartedOn,
+			FinishedOn:   md.BuildFinishedOn,
+		}
+	}
+	return prv
+}
+
+// ProvenanceFromSLSA1 converts a SLSA v1 provenance predicate. SLSA v1 leaves
+// the source to the build type, so it is only set for the configSource
+// external parameter used by BuildKit.
+func ProvenanceFromSLSA1(p *slsa1.ProvenancePredicate) *Provenance {
+	prv := &Provenance{
+		PredicateType:      slsa1.PredicateSLSAProvenance,
+		BuilderID:          p.RunDetails.Builder.ID,
+		BuildType:          p.BuildDefinition.BuildType,
+		Parameters:         p.BuildDefinition.ExternalParameters,
+		InternalParameters: p.BuildDefinition.InternalParameters,
+		Source:             configSource(p.BuildDefinition.ExternalParameters),
+	}
+	for _, d := range p.BuildDefinition.ResolvedDependencies {
+		prv.Materials = append(prv.Materials, ProvenanceMaterial{
+			URI:    d.URI,
+			Name:   d.Name,
+			Digest: d.Digest,
+		})
+	}
+	if md := p.RunDetails.BuildMetadata; md != (slsa1.BuildMetadata{}) {
+		prv.Metadata = &ProvenanceMetadata{
+			InvocationID: md.InvocationID,
+			StartedOn:    md.StartedOn,
+			FinishedOn:   md.FinishedOn,
+		}
+	}
+	return prv
+}
+
+func configSource(params any) *ProvenanceSource {
+	m, ok := params.(map[string]any)
+	if !ok {
+		return nil
+	}
+	dt, err := json.Marshal(m["configSource"])
+	if err != nil {
+		return nil
+	}
+	var cs struct {
+		URI    string            `json:"uri"`
+		Digest map[string]string `json:"digest"`
+		Path   string            `json:"path"`
+	}
+	if err := json.Unmarshal(dt, &cs); err != nil || cs.URI == "" {
+		return nil
+	}
+	return &ProvenanceSource{
+		URI:        cs.URI,
+		Digest:     cs.Digest,
+		EntryPoint: cs.Path,
+	}
+}
@@ -0,0 +1,127 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProvenance(t *testing.T) {
+	started := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	alpine := ProvenanceMaterial{
+		URI:    "pkg:docker/alpine@3.22?platform=linux%2Famd64",
+		Digest: map[string]string{"sha256": "4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"},
+	}
+	source := &ProvenanceSource{
+		URI:        "https://github.com/docker/buildx.git#refs/heads/master",
+		Digest:     map[string]string{"sha1": "6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"},
+		EntryPoint: "Dockerfile",
+	}
+
+	tests := []struct {
+		name          string
+		predicateType string
+		predicate     string
+		want          *Provenance
+		wantErr       string
+	}{
+		{
+			name:          "v0.2",
+			predicateType: "https://slsa.dev/provenance/v0.2",
+			predicate: `{
+				"builder": {"id": "https://github.com/docker/buildx/actions/runs/1"},
+				"buildType": "https://mobyproject.org/buildkit@v1",
+				"materials": [{"uri": "pkg:docker/alpine@3.22?platform=linux%2Famd64", "digest": {"sha256": "4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"}}],
+				"invocation": {
+					"configSource": {"uri": "https://github.com/docker/buildx.git#refs/heads/master", "digest": {"sha1": "6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"}, "entryPoint": "Dockerfile"},
+					"parameters": {"frontend": "dockerfile.v0"},
+					"environment": {"platform": "linux/amd64"}
+				},
+				"metadata": {"buildInvocationID": "abc", "buildStartedOn": "2025-06-01T12:00:00Z"}
+			}`,
+			want: &Provenance{
+				PredicateType:      "https://slsa.dev/provenance/v0.2",
+				BuilderID:          "https://github.com/docker/buildx/actions/runs/1",
+				BuildType:          "https://mobyproject.org/buildkit@v1",
+				Source:             source,
+				Parameters:         map[string]any{"frontend": "dockerfile.v0"},
+				InternalParameters: map[string]any{"platform": "linux/amd64"},
+				Materials:          []ProvenanceMaterial{alpine},
+				Metadata:           &ProvenanceMetadata{InvocationID: "abc", StartedOn: &started},
+			},
+		},
+		{
+			name:          "v1",
+			predicateType: "https://slsa.dev/provenance/v1",
+			predicate: `{
+				"buildDefinition": {
+					"buildType": "https://mobyproject.org/buildkit@v1",
+					"externalParameters": {
+						"configSource": {"uri": "https://github.com/docker/buildx.git#refs/heads/master", "digest": {"sha1": "6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"}, "path": "Dockerfile"},
+						"request": {"frontend": "dockerfile.v0"}
+					},
+					"internalParameters": {"builderPlatform": "linux/amd64"},
+					"resolvedDependencies": [{"uri": "pkg:docker/alpine@3.22?platform=linux%2Famd64", "digest": {"sha256": "4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"}}]
+				},
+				"runDetails": {
+					"builder": {"id": "https://github.com/docker/buildx/actions/runs/1"},
+					"metadata": {"invocationId": "abc", "startedOn": "2025-06-01T12:00:00Z"}
+				}
+			}`,
+			want: &Provenance{
+				PredicateType: "https://slsa.dev/provenance/v1",
+				BuilderID:     "https://github.com/docker/buildx/actions/runs/1",
+				BuildType:     "https://mobyproject.org/buildkit@v1",
+				Source:        source,
+				Parameters: map[string]any{
+					"configSource": map[string]any{
+						"uri":    "https://github.com/docker/buildx.git#refs/heads/master",
+						"digest": map[string]any{"sha1": "6f0e4ae6a0a5d7e9fd7f4b4b9c1a1d4f0b0e3c5d"},
+						"path":   "Dockerfile",
+					},
+					"request": map[string]any{"frontend": "dockerfile.v0"},
+				},
+				InternalParameters: map[string]any{"builderPlatform": "linux/amd64"},
+				Materials:          []ProvenanceMaterial{alpine},
+				Metadata:           &ProvenanceMetadata{InvocationID: "abc", StartedOn: &started},
+			},
+		},
+		{
+			name:          "v1-minimal",
+			predicateType: "https://slsa.dev/provenance/v1",
+			predicate:     `{"buildDefinition": {"buildType": "https://example.com/build@v1"}, "runDetails": {"builder": {"id": "https://example.com/builder"}}}`,
+			want: &Provenance{
+				PredicateType: "https://slsa.dev/provenance/v1",
+				BuilderID:     "https://example.com/builder",
+				BuildType:     "https://example.com/build@v1",
+			},
+		},
+		{
+			name:          "invalid-json",
+			predicateType: "https://slsa.dev/provenance/v1",
+			predicate:     `{`,
+			wantErr:       "unmarshaling SLSA v1 provenance",
+		},
+		{
+			name:          "unknown-predicate",
+			predicateType: "https://spdx.dev/Document",
+			predicate:     `{}`,
+			wantErr:       "expecting SLSA provenance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProvenance(tt.predicateType, []byte(tt.predicate))
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.want.Predicate = json.RawMessage(tt.predicate)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
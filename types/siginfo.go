@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
@@ -57,9 +58,19 @@ type TimestampVerificationResult struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+type TrustRootExpiry struct {
+	Root      time.Time `json:"root"`
+	Timestamp time.Time `json:"timestamp"`
+	Snapshot  time.Time `json:"snapshot"`
+	Targets   time.Time `json:"targets"`
+}
+
 type TrustRootStatus struct {
-	Error       string     `json:"error,omitempty"`
-	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	LastUpdated   *time.Time       `json:"lastUpdated,omitempty"`
+	Expiry        *TrustRootExpiry `json:"expiry,omitempty"`
+	ExpiresSoon   bool             `json:"expiresSoon,omitempty"`
+	LockContended bool             `json:"lockContended,omitempty"`
 }
 
 type SignatureInfo struct {
@@ -70,4 +81,41 @@ type SignatureInfo struct {
 	DockerReference string                        `json:"dockerReference,omitempty"`
 	TrustRootStatus TrustRootStatus               `json:"trustRootStatus,omitzero"`
 	IsDHI           bool                          `json:"isDHI,omitempty"`
+	// DHIKeyID is the ID of the DHI keyring key that verified the signature.
+	DHIKeyID string `json:"dhiKeyId,omitempty"`
+	// TransparencyLog is set when the signature was verified to be included
+	// in the transparency log. Only DHI signatures may not be.
+	TransparencyLog bool `json:"transparencyLog"`
+	// Provenance is the SLSA provenance from the verified attestation.
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// ProvenanceError is set instead of Provenance if the SLSA provenance
+	// was signed but could not be parsed.
+	ProvenanceError string `json:"provenanceError,omitempty"`
+	// Attestations are the statements of the required predicate types from
+	// the verified attestation manifest.
+	Attestations []Attestation `json:"attestations,omitempty"`
+	// BaseImages are the results of verifying the base images listed in
+	// the provenance, if requested.
+	BaseImages []*BaseImage `json:"baseImages,omitempty"`
+}
+
+// BaseImage is the result of verifying a base image from provenance.
+type BaseImage struct {
+	// URI is the material the base image was read from.
+	URI    string `json:"uri"`
+	Image  string `json:"image,omitempty"`
+	Digest string `json:"digest,omitempty"`
+	// SignatureInfo is set if the base image was verified and holds the
+	// results for its own base images.
+	SignatureInfo *SignatureInfo `json:"signatureInfo,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	// WeakestLink marks the base image with the weakest signature in the
+	// tree if it is weaker than the image itself.
+	WeakestLink bool `json:"weakestLink,omitempty"`
+}
+
+// Attestation is an in-toto statement with its predicate left unparsed.
+type Attestation struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
 }
@@ -0,0 +1,164 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SLSALevel is a level of the SLSA Build track.
+type SLSALevel int
+
+const (
+	SLSABuildL0 SLSALevel = 0
+	SLSABuildL1 SLSALevel = 1
+	SLSABuildL2 SLSALevel = 2
+	SLSABuildL3 SLSALevel = 3
+)
+
+func (l SLSALevel) String() string {
+	return fmt.Sprintf("SLSA Build L%d", int(l))
+}
+
+// TrustedBuilder is a build platform trusted to produce provenance up to a
+// SLSA Build level.
+type TrustedBuilder struct {
+	Name  string    `json:"name"`
+	Level SLSALevel `json:"level"`
+	// BuilderIDPrefix is the prefix the builder ID in the provenance must
+	// have. Any builder ID is accepted if empty.
+	BuilderIDPrefix string `json:"builderIdPrefix,omitempty"`
+}
+
+// DHIKeyPrefix is prepended to the ID of a DHI keyring key to key the trusted
+// builder for provenance signed with that key.
+const DHIKeyPrefix = "dhi-key:"
+
+// DefaultTrustedBuilders returns the trusted builders keyed by the prefix of
+// their signing identity, or of DHIKeyPrefix followed by the DHI key ID.
+func DefaultTrustedBuilders() map[string]TrustedBuilder {
+	return map[string]TrustedBuilder{
+		githubBuilderURI: {
+			Name:            "docker/github-builder",
+			Level:           SLSABuildL3,
+			BuilderIDPrefix: githubPrefix,
+		},
+		// any key of the DHI keyring, which does not identify the build
+		// platform
+		DHIKeyPrefix: {
+			Name:  "Docker Hardened Images",
+			Level: SLSABuildL2,
+		},
+	}
+}
+
+// SLSAAssessment is the SLSA Build level of a verified image or artifact.
+type SLSAAssessment struct {
+	Level SLSALevel `json:"level"`
+	// Evidence are the facts the level is based on.
+	Evidence []string `json:"evidence,omitempty"`
+	// Reasons explain why the level is not higher.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// AssessSLSALevel derives the SLSA Build level from the verified signature
+// and provenance. The signing identity decides whether the provenance was
+// generated by a hosted platform (L2) and by a trusted builder that isolates
+// the signing key from the build (L3). Provenance of Docker Hardened Images
+// reaches the level of the trusted builder for its DHI key.
+// DefaultTrustedBuilders is used if trusted is nil.
+func AssessSLSALevel(si SignatureInfo, trusted map[string]TrustedBuilder) SLSAAssessment {
+	if trusted == nil {
+		trusted = DefaultTrustedBuilders()
+	}
+	var a SLSAAssessment
+
+	p := si.Provenance
+	if p == nil {
+		a.Reasons = append(a.Reasons, "no verified SLSA provenance")
+		return a
+	}
+	a.Level = SLSABuildL1
+	a.Evidence = append(a.Evidence, fmt.Sprintf("verified %s provenance with build type %q", p.PredicateType, p.BuildType))
+
+	if si.IsDHI {
+		return assessDHI(a, si, trusted)
+	}
+	if si.Signer == nil {
+		a.Reasons = append(a.Reasons, "signature has no signing identity")
+		return a
+	}
+	if si.Signer.Issuer != githubIssuer {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("signing identity %s from %q is not a hosted build platform", si.Signer.SubjectAlternativeName, si.Signer.Issuer))
+		return a
+	}
+	if si.Signer.RunnerEnvironment != "github-hosted" {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("signed on a %q runner, not a GitHub-hosted runner", si.Signer.RunnerEnvironment))
+		return a
+	}
+	a.Level = SLSABuildL2
+	a.Evidence = append(a.Evidence, fmt.Sprintf("provenance signed by GitHub Actions workflow %s on a GitHub-hosted runner", si.Signer.BuildSignerURI))
+
+	tb, prefix := trustedBuilder(trusted, si.Signer.BuildSignerURI)
+	if prefix == "" {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("signing workflow %s is not a trusted builder", si.Signer.BuildSignerURI))
+		return a
+	}
+	if !strings.HasPrefix(si.Signer.SubjectAlternativeName, prefix) {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("signing identity %s does not match trusted builder %s", si.Signer.SubjectAlternativeName, tb.Name))
+		return a
+	}
+	if tb.BuilderIDPrefix != "" && !strings.HasPrefix(p.BuilderID, tb.BuilderIDPrefix) {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("provenance builder ID %q does not match trusted builder %s", p.BuilderID, tb.Name))
+		return a
+	}
+	if tb.Level < SLSABuildL3 {
+		a.Level = min(a.Level, tb.Level)
+		a.Reasons = append(a.Reasons, fmt.Sprintf("trusted builder %s is only trusted up to %s", tb.Name, tb.Level))
+		return a
+	}
+	a.Level = SLSABuildL3
+	a.Evidence = append(a.Evidence, fmt.Sprintf("provenance generated by trusted builder %s isolated from the calling workflow", tb.Name))
+	return a
+}
+
+// assessDHI assesses provenance signed with a DHI keyring key, which reaches
+// the level of the trusted builder for the key.
+func assessDHI(a SLSAAssessment, si SignatureInfo, trusted map[string]TrustedBuilder) SLSAAssessment {
+	tb, prefix := trustedBuilder(trusted, DHIKeyPrefix+si.DHIKeyID)
+	if prefix == "" {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("Docker Hardened Images key %s is not a trusted builder", si.DHIKeyID))
+		return a
+	}
+	if tb.BuilderIDPrefix != "" && !strings.HasPrefix(si.Provenance.BuilderID, tb.BuilderIDPrefix) {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("provenance builder ID %q does not match trusted builder %s", si.Provenance.BuilderID, tb.Name))
+		return a
+	}
+	if tb.Level < SLSABuildL2 {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("trusted builder %s is only trusted up to %s", tb.Name, tb.Level))
+		return a
+	}
+	a.Level = SLSABuildL2
+	a.Evidence = append(a.Evidence, fmt.Sprintf("provenance signed with Docker Hardened Images key %s of trusted builder %s", si.DHIKeyID, tb.Name))
+	if tb.Level < SLSABuildL3 {
+		a.Reasons = append(a.Reasons, fmt.Sprintf("trusted builder %s is only trusted up to %s", tb.Name, tb.Level))
+		return a
+	}
+	a.Level = SLSABuildL3
+	a.Evidence = append(a.Evidence, fmt.Sprintf("trusted builder %s keeps the signing key isolated from the build", tb.Name))
+	return a
+}
+
+// trustedBuilder returns the trusted builder with the longest key that is a
+// prefix of id, and that key.
+func trustedBuilder(trusted map[string]TrustedBuilder, id string) (TrustedBuilder, string) {
+	var (
+		tb     TrustedBuilder
+		prefix string
+	)
+	for k, v := range trusted {
+		if strings.HasPrefix(id, k) && len(k) > len(prefix) {
+			tb, prefix = v, k
+		}
+	}
+	return tb, prefix
+}
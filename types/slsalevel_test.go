@@ -0,0 +1,135 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssessSLSALevel(t *testing.T) {
+	provenance := &Provenance{
+		PredicateType: "https://slsa.dev/provenance/v1",
+		BuildType:     "https://mobyproject.org/buildkit@v1",
+		BuilderID:     "https://github.com/docker/buildx/actions/runs/1",
+	}
+	signer := func(san, runner string) *certificate.Summary {
+		return &certificate.Summary{
+			CertificateIssuer:      sigstoreIssuer,
+			SubjectAlternativeName: san,
+			Extensions: certificate.Extensions{
+				Issuer:              githubIssuer,
+				RunnerEnvironment:   runner,
+				SourceRepositoryURI: "https://github.com/docker/buildx",
+				BuildSignerURI:      san,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		in      SignatureInfo
+		trusted map[string]TrustedBuilder
+		want    SLSALevel
+		reason  string
+	}{
+		{
+			name:   "no-provenance",
+			in:     SignatureInfo{Signer: signer(githubBuilderURI+"bake.yml", "github-hosted")},
+			want:   SLSABuildL0,
+			reason: "no verified SLSA provenance",
+		},
+		{
+			name: "self-signed-user",
+			in: SignatureInfo{
+				Provenance: provenance,
+				Signer: &certificate.Summary{
+					CertificateIssuer:      sigstoreIssuer,
+					SubjectAlternativeName: "user@example.com",
+					Extensions:             certificate.Extensions{Issuer: googleUserIssuer},
+				},
+			},
+			want:   SLSABuildL1,
+			reason: "is not a hosted build platform",
+		},
+		{
+			name:   "self-hosted-runner",
+			in:     SignatureInfo{Provenance: provenance, Signer: signer(githubBuilderURI+"bake.yml", "self-hosted")},
+			want:   SLSABuildL1,
+			reason: "not a GitHub-hosted runner",
+		},
+		{
+			name:   "repo-workflow",
+			in:     SignatureInfo{Provenance: provenance, Signer: signer("https://github.com/docker/buildx/.github/workflows/build.yml@refs/heads/master", "github-hosted")},
+			want:   SLSABuildL2,
+			reason: "is not a trusted builder",
+		},
+		{
+			name:   "dhi",
+			in:     SignatureInfo{Provenance: provenance, IsDHI: true, DHIKeyID: "key1", DockerReference: "docker.io/dhi/golang"},
+			want:   SLSABuildL2,
+			reason: "trusted builder Docker Hardened Images is only trusted up to SLSA Build L2",
+		},
+		{
+			name:    "dhi-untrusted-key",
+			in:      SignatureInfo{Provenance: provenance, IsDHI: true, DHIKeyID: "key2"},
+			trusted: map[string]TrustedBuilder{DHIKeyPrefix + "key1": {Name: "dhi", Level: SLSABuildL3}},
+			want:    SLSABuildL1,
+			reason:  "key key2 is not a trusted builder",
+		},
+		{
+			name:    "dhi-wrong-builder-id",
+			in:      SignatureInfo{Provenance: provenance, IsDHI: true, DHIKeyID: "key1"},
+			trusted: map[string]TrustedBuilder{DHIKeyPrefix + "key1": {Name: "dhi", Level: SLSABuildL3, BuilderIDPrefix: "https://dhi.example.com/"}},
+			want:    SLSABuildL1,
+			reason:  "does not match trusted builder dhi",
+		},
+		{
+			name:    "dhi-trusted-key",
+			in:      SignatureInfo{Provenance: &Provenance{PredicateType: provenance.PredicateType, BuilderID: "https://dhi.example.com/builder"}, IsDHI: true, DHIKeyID: "key1"},
+			trusted: map[string]TrustedBuilder{DHIKeyPrefix + "key1": {Name: "dhi", Level: SLSABuildL3, BuilderIDPrefix: "https://dhi.example.com/"}},
+			want:    SLSABuildL3,
+		},
+		{
+			name: "github-builder-wrong-builder-id",
+			in: SignatureInfo{
+				Provenance: &Provenance{PredicateType: provenance.PredicateType, BuilderID: "https://example.com/builder"},
+				Signer:     signer(githubBuilderURI+"bake.yml", "github-hosted"),
+			},
+			want:   SLSABuildL2,
+			reason: "does not match trusted builder docker/github-builder",
+		},
+		{
+			name:    "github-builder-lowered",
+			in:      SignatureInfo{Provenance: provenance, Signer: signer(githubBuilderURI+"bake.yml", "github-hosted")},
+			trusted: map[string]TrustedBuilder{githubBuilderURI: {Name: "docker/github-builder", Level: SLSABuildL2}},
+			want:    SLSABuildL2,
+			reason:  "only trusted up to SLSA Build L2",
+		},
+		{
+			name: "github-builder",
+			in:   SignatureInfo{Provenance: provenance, Signer: signer(githubBuilderURI+"bake.yml", "github-hosted")},
+			want: SLSABuildL3,
+		},
+		{
+			name:    "custom-builder",
+			in:      SignatureInfo{Provenance: provenance, Signer: signer("https://github.com/example/builder/.github/workflows/build.yml@refs/tags/v1", "github-hosted")},
+			trusted: map[string]TrustedBuilder{"https://github.com/example/builder/.github/workflows/": {Name: "example/builder", Level: SLSABuildL3}},
+			want:    SLSABuildL3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := AssessSLSALevel(tt.in, tt.trusted)
+			require.Equal(t, tt.want, a.Level)
+			require.Len(t, a.Evidence, int(tt.want))
+			if tt.reason == "" {
+				require.Empty(t, a.Reasons)
+				return
+			}
+			require.Len(t, a.Reasons, 1)
+			require.Contains(t, a.Reasons[0], tt.reason)
+		})
+	}
+}
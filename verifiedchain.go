@@ -0,0 +1,87 @@
+package verifier
+
+import (
+	"context"
+
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// VerifiedChain is a signature chain whose attestation manifest signature has
+// been verified. It is only returned by the verifier, so the layers it gives
+// access to are covered by the verified signature.
+type VerifiedChain struct {
+	SignatureInfo *types.SignatureInfo
+
+	chain    *image.SignatureChain
+	manifest *ocispecs.Manifest
+	// statements are the statements read while verifying the chain
+	statements []*statement
+}
+
+// VerifyImageChain verifies the signature chain of the image manifest for
+// platform like VerifyImage and returns the verified chain.
+func (v *Verifier) VerifyImageChain(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform, opt ...ImageVerifyOpt) (*VerifiedChain, error) {
+	opts := &ImageVerifyOpts{}
+	for _, o := range opt {
+		o(opts)
+	}
+
+	sc, err := image.ResolveSignatureChain(ctx, provider, desc, platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving signature chain for image %s", desc.Digest)
+	}
+	if sc.DHI && len(opts.PredicateTypes) > 0 {
+		return nil, errors.Errorf("DHI image %s has an attestation manifest for every predicate type, use VerifyDHIAttestations to verify them", desc.Digest)
+	}
+	return v.verifySignatureChain(ctx, sc, desc.Digest, opts)
+}
+
+func (vc *VerifiedChain) check() error {
+	if vc == nil || vc.chain == nil || vc.manifest == nil {
+		return errors.WithStack(&UnverifiedChainError{})
+	}
+	return nil
+}
+
+// ImageManifest returns the descriptor of the image manifest the chain was
+// verified for.
+func (vc *VerifiedChain) ImageManifest() (ocispecs.Descriptor, error) {
+	if err := vc.check(); err != nil {
+		return ocispecs.Descriptor{}, err
+	}
+	return vc.chain.ImageManifest.Descriptor, nil
+}
+
+// AttestationManifest returns the verified attestation manifest.
+func (vc *VerifiedChain) AttestationManifest() (ocispecs.Descriptor, *ocispecs.Manifest, error) {
+	if err := vc.check(); err != nil {
+		return ocispecs.Descriptor{}, nil, err
+	}
+	return vc.chain.AttestationManifest.Descriptor, vc.manifest, nil
+}
+
+// Layers returns the layers of the verified attestation manifest.
+func (vc *VerifiedChain) Layers() ([]ocispecs.Descriptor, error) {
+	if err := vc.check(); err != nil {
+		return nil, err
+	}
+	return vc.manifest.Layers, nil
+}
+
+// ReadLayer reads a layer of the verified attestation manifest and checks it
+// against its digest.
+func (vc *VerifiedChain) ReadLayer(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if err := vc.check(); err != nil {
+		return nil, err
+	}
+	for _, l := range vc.manifest.Layers {
+		if l.Digest == dgst {
+			return image.ReadBlob(ctx, vc.chain.Provider, l)
+		}
+	}
+	return nil, errors.Errorf("layer %s not found in attestation manifest %s", dgst, vc.chain.AttestationManifest.Digest)
+}
@@ -0,0 +1,117 @@
+package verifier
+
+import (
+	"context"
+	"testing"
+
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/roots"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifiedChainUnverified(t *testing.T) {
+	for name, vc := range map[string]*VerifiedChain{
+		"nil":   nil,
+		"empty": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var target *UnverifiedChainError
+
+			_, err := vc.ImageManifest()
+			require.ErrorAs(t, err, &target)
+			_, _, err = vc.AttestationManifest()
+			require.ErrorAs(t, err, &target)
+			_, err = vc.Layers()
+			require.ErrorAs(t, err, &target)
+			_, err = vc.ReadLayer(context.TODO(), "sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1")
+			require.ErrorAs(t, err, &target)
+		})
+	}
+}
+
+func TestVerifiedChainReadLayer(t *testing.T) {
+	store := newTestStore(t)
+	layer := store.add(mediaTypeInTotoStatement, []byte(`{"_type":"https://in-toto.io/Statement/v1"}`))
+	tampered := store.add(mediaTypeInTotoStatement, []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`))
+	store.replace(tampered.Digest, []byte(`{"_type":"https://in-toto.io/Statement/v1","predicate":{}}`))
+	mfst := &ocispecs.Manifest{Layers: []ocispecs.Descriptor{layer, tampered}}
+
+	vc := &VerifiedChain{
+		chain: &image.SignatureChain{
+			AttestationManifest: &image.Manifest{Descriptor: store.addJSON(ocispecs.MediaTypeImageManifest, mfst)},
+			Provider:            store,
+		},
+		manifest: mfst,
+	}
+
+	dt, err := vc.ReadLayer(context.TODO(), layer.Digest)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"_type":"https://in-toto.io/Statement/v1"}`, string(dt))
+
+	_, err = vc.ReadLayer(context.TODO(), tampered.Digest)
+	require.ErrorContains(t, err, "digest mismatch")
+
+	_, err = vc.ReadLayer(context.TODO(), digest.FromString("other"))
+	require.ErrorContains(t, err, "not found in attestation manifest")
+}
+
+func TestVerifyImageChain(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	img := newTestDHIImage(t, key)
+	provenance := img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{})
+	att := img.attest(slsa1.PredicateSLSAProvenance, provenance)
+
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	vc, err := v.VerifyImageChain(t.Context(), img.store, img.index, &testPlatform)
+	require.NoError(t, err)
+	require.True(t, vc.SignatureInfo.IsDHI)
+	require.NotNil(t, vc.SignatureInfo.Provenance)
+	// the statement is read once while verifying
+	require.Equal(t, 1, img.store.readCount(provenance.Digest))
+
+	desc, err := vc.ImageManifest()
+	require.NoError(t, err)
+	require.Equal(t, img.manifest.Digest, desc.Digest)
+	desc, mfst, err := vc.AttestationManifest()
+	require.NoError(t, err)
+	require.Equal(t, att.Digest, desc.Digest)
+	require.Equal(t, []ocispecs.Descriptor{provenance}, mfst.Layers)
+	layers, err := vc.Layers()
+	require.NoError(t, err)
+	require.Equal(t, mfst.Layers, layers)
+	dt, err := vc.ReadLayer(t.Context(), provenance.Digest)
+	require.NoError(t, err)
+	require.Equal(t, provenance.Digest, digest.FromBytes(dt))
+}
+
+func TestVerifyImageChainFailed(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	img := newTestDHIImage(t, newTestDHIKey(t))
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, newTestDHIKey(t).key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	vc, err := v.VerifyImageChain(t.Context(), img.store, img.index, &testPlatform)
+	require.Error(t, err)
+
+	var target *UnverifiedChainError
+	_, err = vc.ImageManifest()
+	require.ErrorAs(t, err, &target)
+	_, err = vc.Layers()
+	require.ErrorAs(t, err, &target)
+	_, err = vc.ReadLayer(t.Context(), img.manifest.Digest)
+	require.ErrorAs(t, err, &target)
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
@@ -28,25 +32,136 @@ type Config struct {
 	UpdateInterval time.Duration
 	RequireOnline  bool
 	StateDir       string
+	// TrustRootWaitTimeout is how long a verification waits for a pending
+	// trust root update before using the previous trust root.
+	TrustRootWaitTimeout time.Duration
+	// TUFHTTPClient, TUFMirrors and TUFRequestTimeout configure fetching
+	// the trust root from the TUF repository. See roots.SigstoreRootsConfig.
+	TUFHTTPClient     *http.Client
+	TUFMirrors        []string
+	TUFRequestTimeout time.Duration
+	// StateDirLockTimeout is how long to wait for another process holding
+	// the lock on the state directory.
+	StateDirLockTimeout time.Duration
+	// InMemoryState keeps the trust root state in memory so that nothing is
+	// written to disk. StateDir is optional and only read to seed the state.
+	InMemoryState bool
+	// TrustProvider is a trust provider shared with other verifiers in the
+	// process. If set, the other trust root options are ignored and the
+	// caller remains responsible for closing it after the verifiers.
+	TrustProvider *roots.TrustProvider
+	// DHIKeyringPath is a file with the keyring that DHI images are signed
+	// with. See dhi.ParseKeyring for the format. The file is read again
+	// after each trust root update, so changes are not picked up if
+	// UpdateInterval is not set.
+	DHIKeyringPath string
+	// DHIKeyringTarget is the name of a TUF target with the DHI keyring. It
+	// is used if DHIKeyringPath is not set. If neither is set, the key
+	// embedded in the binary is used. A configured keyring that fails to
+	// load is never replaced by the embedded key.
+	DHIKeyringTarget string
 }
 
 type Verifier struct {
 	cfg Config
 	sf  singleflight.Group
-	tp  *roots.TrustProvider // tp may be nil if initialization failed
+
+	mu      sync.Mutex
+	tp      *roots.TrustProvider // tp may be nil if initialization failed
+	closed  bool
+	subs    map[int]func(roots.Event)
+	nextSub int
+	// unsubscribe removes the subscription to the trust provider events
+	unsubscribe func()
+	// keyring is the last DHI keyring that loaded from the configured
+	// source. It is reloaded after trust root updates.
+	keyring      *dhi.Keyring
+	keyringFresh bool
+	keyringGen   int
 }
 
 func NewVerifier(cfg Config) (*Verifier, error) {
-	if cfg.StateDir == "" {
+	if cfg.StateDir == "" && !cfg.InMemoryState && cfg.TrustProvider == nil {
 		return nil, errors.Errorf("state directory must be provided")
 	}
 	v := &Verifier{cfg: cfg}
 
+	if cfg.TrustProvider != nil {
+		v.tp = cfg.TrustProvider
+		v.unsubscribe = cfg.TrustProvider.Subscribe(v.notify)
+		return v, nil
+	}
+
 	v.loadTrustProvider() // initialization fails on expired root/timestamp
 
 	return v, nil
 }
 
+// Close stops the background trust root updates unless the trust provider
+// is shared through Config.TrustProvider. Verifications after Close return
+// ErrClosed.
+func (v *Verifier) Close() error {
+	v.mu.Lock()
+	v.closed = true
+	tp, unsubscribe := v.tp, v.unsubscribe
+	v.unsubscribe = nil
+	v.mu.Unlock()
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+	if tp == nil || v.cfg.TrustProvider != nil {
+		return nil
+	}
+	return tp.Close()
+}
+
+// WaitReady blocks until the trust root has been updated from the TUF
+// repository, so that callers can delay startup until a fresh root is
+// available.
+func (v *Verifier) WaitReady(ctx context.Context) error {
+	tp, err := v.loadTrustProvider()
+	if err != nil {
+		return errors.Wrap(err, "loading trust provider")
+	}
+	return tp.WaitReady(ctx)
+}
+
+// SubscribeTrustRoot registers fn to be called when the trust root is updated
+// or fails to update. Subscriptions made before the trust root could be
+// loaded receive events once it is. The returned function removes the
+// subscription.
+func (v *Verifier) SubscribeTrustRoot(fn func(roots.Event)) func() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.subs == nil {
+		v.subs = map[int]func(roots.Event){}
+	}
+	id := v.nextSub
+	v.nextSub++
+	v.subs[id] = fn
+	return func() {
+		v.mu.Lock()
+		delete(v.subs, id)
+		v.mu.Unlock()
+	}
+}
+
+func (v *Verifier) notify(ev roots.Event) {
+	v.mu.Lock()
+	if ev.Type == roots.EventUpdated {
+		v.keyringFresh = false
+		v.keyringGen++
+	}
+	subs := make([]func(roots.Event), 0, len(v.subs))
+	for _, fn := range v.subs {
+		subs = append(subs, fn)
+	}
+	v.mu.Unlock()
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
 func (v *Verifier) VerifyArtifact(ctx context.Context, dgst digest.Digest, bundleBytes []byte, opt ...ArtifactVerifyOpt) (*types.SignatureInfo, error) {
 	opts := &ArtifactVerifyOpts{}
 	for _, o := range opt {
@@ -101,20 +216,84 @@ func (v *Verifier) VerifyArtifact(ctx context.Context, dgst digest.Digest, bundl
 		Signer:          result.Signature.Certificate,
 		Timestamps:      toTimestamps(result.VerifiedTimestamps),
 		SignatureType:   types.SignatureBundleV03,
+		TransparencyLog: true,
+	}
+	if result.Statement != nil && isSLSAPredicateType(result.Statement.PredicateType) {
+		predicate, err := result.Statement.Predicate.MarshalJSON()
+		if err != nil {
+			return nil, errors.Wrap(err, "marshaling SLSA provenance predicate")
+		}
+		// the signature is valid even if the provenance is not
+		if si.Provenance, err = types.ParseProvenance(result.Statement.PredicateType, predicate); err != nil {
+			si.ProvenanceError = err.Error()
+		}
 	}
 	si.Kind = si.DetectKind()
 	return si, nil
 }
 
-func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform) (*types.SignatureInfo, error) {
+func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProvider, desc ocispecs.Descriptor, platform *ocispecs.Platform, opt ...ImageVerifyOpt) (*types.SignatureInfo, error) {
+	opts := &ImageVerifyOpts{}
+	for _, o := range opt {
+		o(opts)
+	}
+
 	sc, err := image.ResolveSignatureChain(ctx, provider, desc, platform)
 	if err != nil {
 		return nil, errors.Wrapf(err, "resolving signature chain for image %s", desc.Digest)
 	}
+	if !sc.DHI || len(opts.PredicateTypes) == 0 {
+		vc, err := v.verifySignatureChain(ctx, sc, desc.Digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		return v.withBaseImages(ctx, vc.SignatureInfo, desc, platform, opts), nil
+	}
 
+	// DHI images have an attestation manifest for every predicate type, so
+	// the required types are verified from their own manifests next to the
+	// provenance
+	provOpts := *opts
+	provOpts.PredicateTypes = nil
+	vc, err := v.verifySignatureChain(ctx, sc, desc.Digest, &provOpts)
+	if err != nil {
+		return nil, err
+	}
+	si := vc.SignatureInfo
+	attOpts := *opts
+	attOpts.SLSARequired = false
+	atts, err := v.verifyDHIAttestations(ctx, provider, desc, platform, &attOpts, func(pt string) bool {
+		return slices.Contains(opts.PredicateTypes, pt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pt := range opts.PredicateTypes {
+		for _, att := range atts[pt] {
+			si.Attestations = append(si.Attestations, types.Attestation{
+				PredicateType: att.PredicateType,
+				Predicate:     att.Predicate,
+			})
+		}
+	}
+	return v.withBaseImages(ctx, si, desc, platform, opts), nil
+}
+
+// withBaseImages verifies the base images of si if requested.
+func (v *Verifier) withBaseImages(ctx context.Context, si *types.SignatureInfo, desc ocispecs.Descriptor, platform *ocispecs.Platform, opts *ImageVerifyOpts) *types.SignatureInfo {
+	if opts.BaseImageResolver != nil {
+		v.verifyBaseImages(ctx, si, platform, opts, []digest.Digest{desc.Digest})
+		markWeakestLink(si)
+	}
+	return si
+}
+
+// verifySignatureChain verifies the signature of the attestation manifest in
+// sc and that the attestation manifest belongs to the image manifest.
+func (v *Verifier) verifySignatureChain(ctx context.Context, sc *image.SignatureChain, target digest.Digest, opts *ImageVerifyOpts) (*VerifiedChain, error) {
 	if sc.AttestationManifest == nil || sc.SignatureManifest == nil {
 		return nil, errors.WithStack(&NoSigChainError{
-			Target:         desc.Digest,
+			Target:         target,
 			HasAttestation: sc.AttestationManifest != nil,
 		})
 	}
@@ -141,15 +320,23 @@ func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProv
 	if attestation.Subject.Size != sc.ImageManifest.Size {
 		return nil, errors.Errorf("attestation manifest %s subject size %d does not match image manifest size %d", sc.AttestationManifest.Digest, attestation.Subject.Size, sc.ImageManifest.Size)
 	}
-	hasSLSA := false
+	predicateTypes := map[string]struct{}{}
 	for _, l := range attestation.Layers {
-		if isSLSAPredicateType(l.Annotations["in-toto.io/predicate-type"]) {
-			hasSLSA = true
-			break
+		if pt, ok := l.Annotations[image.AnnotationInTotoPredicateType]; ok {
+			predicateTypes[pt] = struct{}{}
 		}
 	}
-	if !hasSLSA {
-		return nil, errors.Errorf("attestation manifest %s has no SLSA provenance layer", sc.AttestationManifest.Digest)
+	if len(opts.PredicateTypes) == 0 || opts.SLSARequired {
+		_, hasSLSA02 := predicateTypes[slsa02.PredicateSLSAProvenance]
+		_, hasSLSA1 := predicateTypes[slsa1.PredicateSLSAProvenance]
+		if !hasSLSA02 && !hasSLSA1 && !opts.slsaNotRequired {
+			return nil, errors.Errorf("attestation manifest %s has no SLSA provenance layer", sc.AttestationManifest.Digest)
+		}
+	}
+	for _, pt := range opts.PredicateTypes {
+		if _, ok := predicateTypes[pt]; !ok {
+			return nil, errors.Errorf("attestation manifest %s has no %s layer", sc.AttestationManifest.Digest, pt)
+		}
 	}
 
 	anyCert, err := anyCerificateIdentity()
@@ -162,7 +349,6 @@ func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProv
 	if err != nil {
 		return nil, errors.Wrap(err, "loading trust provider")
 	}
-	var trustedRoot root.TrustedMaterial
 	fulcioRoot, st, err := tp.TrustedRoot(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting trusted root")
@@ -265,15 +451,16 @@ func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProv
 	}
 
 	verifierOpts := []verify.VerifierOption{}
+	tlog := true
 
 	if sc.DHI {
-		trustedRoot, err = dhi.TrustedRoot(fulcioRoot)
-		if err != nil {
-			return nil, errors.Wrap(err, "getting DHI trust root")
-		}
-		// DHI signature may or may not have transparency data
-		// validation needs to be done in a later additional policy step
+		// DHI signature may or may not have transparency data. Whether it
+		// had is reported in SignatureInfo unless it is required.
 		if _, hasBundleAnnotation := layer.Annotations["dev.sigstore.cosign/bundle"]; !hasBundleAnnotation {
+			if opts.DHITransparencyLogRequired {
+				return nil, errors.Errorf("DHI signature manifest %s is not transparency logged", sc.SignatureManifest.Digest)
+			}
+			tlog = false
 			verifierOpts = append(verifierOpts, verify.WithNoObserverTimestamps())
 		} else {
 			verifierOpts = append(verifierOpts,
@@ -284,23 +471,35 @@ func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProv
 		// signed with pubkey without cert identity
 		anyCert = verify.WithoutIdentitiesUnsafe()
 	} else {
-		trustedRoot = fulcioRoot
 		verifierOpts = append(verifierOpts,
 			verify.WithObserverTimestamps(1),
 			verify.WithTransparencyLog(1),
 			verify.WithSignedCertificateTimestamps(1),
 		)
 	}
-	gv, err := verify.NewVerifier(trustedRoot, verifierOpts...)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating verifier")
-	}
 
 	policy := verify.NewPolicy(artifactPolicy, anyCert)
 
-	result, err := gv.Verify(se, policy)
-	if err != nil {
-		return nil, errors.Wrap(err, "verifying bundle")
+	var result *verify.VerificationResult
+	var dhiKey *dhi.Key
+	if sc.DHI {
+		keyring, err := v.dhiKeyring(ctx, tp)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading DHI keyring")
+		}
+		result, dhiKey, err = verifyDHI(se, policy, fulcioRoot, keyring, verifierOpts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		gv, err := verify.NewVerifier(fulcioRoot, verifierOpts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating verifier")
+		}
+		result, err = gv.Verify(se, policy)
+		if err != nil {
+			return nil, errors.Wrap(err, "verifying bundle")
+		}
 	}
 
 	if result.Signature == nil || (result.Signature.Certificate == nil && !sc.DHI) {
@@ -314,25 +513,167 @@ func (v *Verifier) VerifyImage(ctx context.Context, provider image.ReferrersProv
 		DockerReference: dockerReference,
 		IsDHI:           sc.DHI,
 		SignatureType:   sigType,
+		TransparencyLog: tlog,
+	}
+	if dhiKey != nil {
+		si.DHIKeyID = dhiKey.ID
+	}
+	// statements are read by digest from the signed attestation manifest.
+	// Other attestations, such as SBOMs, are left unread.
+	stmts, err := readStatements(ctx, sc, &attestation, func(pt string) bool {
+		return isSLSAPredicateType(pt) || slices.Contains(opts.PredicateTypes, pt) || (opts.statementTypes != nil && opts.statementTypes(pt))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range stmts {
+		if isSLSAPredicateType(stmt.PredicateType) && si.Provenance == nil && si.ProvenanceError == "" {
+			if si.Provenance, err = types.ParseProvenance(stmt.PredicateType, stmt.Predicate); err != nil {
+				si.ProvenanceError = err.Error()
+			}
+		}
+		if slices.Contains(opts.PredicateTypes, stmt.PredicateType) {
+			si.Attestations = append(si.Attestations, types.Attestation{
+				PredicateType: stmt.PredicateType,
+				Predicate:     stmt.Predicate,
+			})
+		}
 	}
 	si.Kind = si.DetectKind()
-	return si, nil
+	return &VerifiedChain{
+		SignatureInfo: si,
+		chain:         sc,
+		manifest:      &attestation,
+		statements:    stmts,
+	}, nil
+}
+
+// dhiKeyring returns the keyring from the configured source, or the embedded
+// keyring if none is configured. If reloading the configured keyring after a
+// trust root update fails, the previous one is kept. Errors are not hidden by
+// falling back to the embedded keyring as the configured keyring may have
+// revoked its keys.
+func (v *Verifier) dhiKeyring(ctx context.Context, tp *roots.TrustProvider) (*dhi.Keyring, error) {
+	v.mu.Lock()
+	last, fresh, gen := v.keyring, v.keyringFresh, v.keyringGen
+	v.mu.Unlock()
+	if last != nil && fresh {
+		return last, nil
+	}
+
+	var keyring *dhi.Keyring
+	var dt []byte
+	var err error
+	switch {
+	case v.cfg.DHIKeyringPath != "":
+		dt, err = os.ReadFile(v.cfg.DHIKeyringPath)
+	case v.cfg.DHIKeyringTarget != "":
+		dt, _, err = tp.Target(ctx, v.cfg.DHIKeyringTarget)
+	default:
+		return dhi.EmbeddedKeyring()
+	}
+	if err == nil {
+		keyring, err = dhi.ParseKeyring(dt)
+	}
+	if err != nil {
+		if last != nil {
+			return last, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	v.mu.Lock()
+	if v.keyringGen == gen {
+		v.keyring = keyring
+		v.keyringFresh = true
+	}
+	v.mu.Unlock()
+	return keyring, nil
+}
+
+// verifyDHI verifies a DHI signature with the key matching its key hint, or
+// otherwise with every key in the keyring until one succeeds. The key must be
+// valid at all verified timestamps, or at the current time if the signature
+// has none. Signatures that were not transparency logged therefore stop
+// verifying once their key expires.
+func verifyDHI(se verify.SignedEntity, policy verify.PolicyBuilder, fulcioRoot root.TrustedMaterial, keyring *dhi.Keyring, opts []verify.VerifierOption) (*verify.VerificationResult, *dhi.Key, error) {
+	var hint string
+	if vc, err := se.VerificationContent(); err == nil {
+		if pk := vc.PublicKey(); pk != nil {
+			hint = pk.Hint()
+		}
+	}
+
+	var lastErr error
+	for _, key := range keyring.Candidates(hint) {
+		trustedRoot, err := dhi.TrustedRoot(fulcioRoot, key)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting DHI trust root")
+		}
+		gv, err := verify.NewVerifier(trustedRoot, opts...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "creating verifier")
+		}
+		result, err := gv.Verify(se, policy)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "verifying bundle with DHI key %s", key.ID)
+			continue
+		}
+
+		times := []time.Time{time.Now()}
+		if len(result.VerifiedTimestamps) > 0 {
+			times = times[:0]
+			for _, ts := range result.VerifiedTimestamps {
+				times = append(times, ts.Timestamp)
+			}
+		}
+		for _, t := range times {
+			if err := key.ValidAt(t); err != nil {
+				return nil, nil, err
+			}
+		}
+		return result, key, nil
+	}
+	return nil, nil, lastErr
 }
 
 func (v *Verifier) loadTrustProvider() (*roots.TrustProvider, error) {
 	res, err, _ := v.sf.Do("", func() (any, error) {
-		if v.tp != nil {
-			return v.tp, nil
+		v.mu.Lock()
+		tp, closed := v.tp, v.closed
+		v.mu.Unlock()
+		if closed {
+			return nil, errors.WithStack(ErrClosed)
+		}
+		if tp != nil {
+			return tp, nil
+		}
+		var cachePath string
+		if v.cfg.StateDir != "" {
+			cachePath = filepath.Join(v.cfg.StateDir, "tuf")
 		}
 		tp, err := roots.NewTrustProvider(roots.SigstoreRootsConfig{
-			CachePath:      filepath.Join(v.cfg.StateDir, "tuf"),
+			CachePath:      cachePath,
 			UpdateInterval: v.cfg.UpdateInterval,
 			RequireOnline:  v.cfg.RequireOnline,
+			WaitTimeout:    v.cfg.TrustRootWaitTimeout,
+			HTTPClient:     v.cfg.TUFHTTPClient,
+			Mirrors:        v.cfg.TUFMirrors,
+			RequestTimeout: v.cfg.TUFRequestTimeout,
+			LockTimeout:    v.cfg.StateDirLockTimeout,
+			InMemory:       v.cfg.InMemoryState,
 		})
 		if err != nil {
 			return nil, err
 		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.closed {
+			tp.Close()
+			return nil, errors.WithStack(ErrClosed)
+		}
 		v.tp = tp
+		v.unsubscribe = tp.Subscribe(v.notify)
 		return tp, nil
 	})
 	if err != nil {
@@ -378,6 +719,60 @@ func WithSLSANotRequired() ArtifactVerifyOpt {
 	}
 }
 
+type ImageVerifyOpts struct {
+	// DHITransparencyLogRequired rejects DHI signatures that are not
+	// included in the transparency log with an observer timestamp.
+	DHITransparencyLogRequired bool
+
+	// PredicateTypes are the in-toto predicate types that the signed
+	// attestation manifest must contain. Their statements are returned in
+	// SignatureInfo. SLSA provenance is required if none are set. For DHI
+	// images, each type is verified from its own attestation manifest.
+	PredicateTypes []string
+	// SLSARequired keeps SLSA provenance required when PredicateTypes are
+	// set.
+	SLSARequired bool
+
+	// BaseImageResolver enables verifying the base images from the verified
+	// provenance, see WithBaseImages.
+	BaseImageResolver BaseImageResolver
+	// BaseImageMaxDepth limits how many levels of base images are verified.
+	// DefaultBaseImageMaxDepth is used if not set.
+	BaseImageMaxDepth int
+
+	// slsaNotRequired is set when verifying attestations other than the
+	// provenance of an image
+	slsaNotRequired bool
+	// statementTypes selects statements that are read in addition to the
+	// provenance and PredicateTypes
+	statementTypes func(predicateType string) bool
+}
+
+type ImageVerifyOpt func(*ImageVerifyOpts)
+
+func WithDHITransparencyLogRequired() ImageVerifyOpt {
+	return func(o *ImageVerifyOpts) {
+		o.DHITransparencyLogRequired = true
+	}
+}
+
+// WithRequiredPredicateTypes requires the signed attestation manifest to
+// contain statements of all the predicate types instead of SLSA provenance.
+// Combine with WithSLSARequired to require both.
+func WithRequiredPredicateTypes(predicateTypes ...string) ImageVerifyOpt {
+	return func(o *ImageVerifyOpts) {
+		o.PredicateTypes = append(o.PredicateTypes, predicateTypes...)
+	}
+}
+
+// WithSLSARequired requires SLSA provenance, of either version, in addition to
+// the types from WithRequiredPredicateTypes.
+func WithSLSARequired() ImageVerifyOpt {
+	return func(o *ImageVerifyOpts) {
+		o.SLSARequired = true
+	}
+}
+
 func loadBundle(dt []byte) (*bundle.Bundle, error) {
 	var bundle bundle.Bundle
 	bundle.Bundle = new(protobundle.Bundle)
@@ -422,10 +817,20 @@ func toTimestamps(ts []verify.TimestampVerificationResult) []types.TimestampVeri
 
 func toRootStatus(st roots.Status) types.TrustRootStatus {
 	trs := types.TrustRootStatus{
-		LastUpdated: st.LastUpdated,
+		LastUpdated:   st.LastUpdated,
+		ExpiresSoon:   st.ExpiresSoon,
+		LockContended: st.LockContended,
 	}
 	if st.Error != nil {
 		trs.Error = st.Error.Error()
 	}
+	if st.Expiry != nil {
+		trs.Expiry = &types.TrustRootExpiry{
+			Root:      st.Expiry.Root,
+			Timestamp: st.Expiry.Timestamp,
+			Snapshot:  st.Expiry.Snapshot,
+			Targets:   st.Expiry.Targets,
+		}
+	}
 	return trs
 }
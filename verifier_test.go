@@ -0,0 +1,583 @@
+package verifier
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/policy-helpers/image"
+	"github.com/moby/policy-helpers/internal/tufrepo"
+	"github.com/moby/policy-helpers/internal/tuftest"
+	"github.com/moby/policy-helpers/roots"
+	"github.com/moby/policy-helpers/roots/dhi"
+	"github.com/moby/policy-helpers/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// newTestTrustProvider returns an in-memory trust provider for a test TUF
+// repository with targets. The embedded Sigstore trusted root is used unless
+// targets has one.
+func newTestTrustProvider(t *testing.T, cfg roots.SigstoreRootsConfig, targets map[string][]byte) (*roots.TrustProvider, *tuftest.Repo) {
+	t.Helper()
+	trustedRoot, err := roots.EmbeddedTUF.ReadFile("tuf-root/targets/trusted_root.json")
+	require.NoError(t, err)
+	targets = maps.Clone(targets)
+	if targets == nil {
+		targets = map[string][]byte{}
+	}
+	if _, ok := targets["trusted_root.json"]; !ok {
+		targets["trusted_root.json"] = trustedRoot
+	}
+	repo := tuftest.NewRepo(t, targets)
+
+	cfg.InMemory = true
+	cfg.NewFetcher = repo.NewFetcher
+	tufrepo.SetRepository(&cfg, tufrepo.Repository{URL: tuftest.URL, Root: repo.Root(), Seed: repo.Seed()})
+	tp, err := roots.NewTrustProvider(cfg)
+	require.NoError(t, err)
+	require.NoError(t, tp.WaitReady(t.Context()))
+	return tp, repo
+}
+
+func TestVerifierSharedTrustProvider(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tp, repo := newTestTrustProvider(t, roots.SigstoreRootsConfig{UpdateInterval: 10 * time.Millisecond}, nil)
+	defer tp.Close()
+
+	v1, err := NewVerifier(Config{TrustProvider: tp})
+	require.NoError(t, err)
+	v2, err := NewVerifier(Config{TrustProvider: tp})
+	require.NoError(t, err)
+
+	var closed atomic.Int64
+	v1.SubscribeTrustRoot(func(roots.Event) {
+		closed.Add(1)
+	})
+	events := make(chan roots.Event, 100)
+	v2.SubscribeTrustRoot(func(ev roots.Event) {
+		select {
+		case events <- ev:
+		default:
+		}
+	})
+	next := func() roots.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for trust root event")
+		}
+		return roots.Event{}
+	}
+
+	require.Eventually(t, func() bool {
+		return closed.Load() > 0
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, v1.Close())
+	// the shared trust provider is not closed with the verifier
+	require.NoError(t, v2.WaitReady(t.Context()))
+	_, err = v1.loadTrustProvider()
+	require.ErrorIs(t, err, ErrClosed)
+
+	// an update that was notifying while v1 was closed may still reach it
+	next()
+	next()
+	n := closed.Load()
+
+	repo.SetTarget("keyring.json", []byte(`{}`))
+	repo.Publish()
+	for {
+		ev := next()
+		require.Equal(t, roots.EventUpdated, ev.Type)
+		if _, ok := ev.ChangedTargets["keyring.json"]; ok {
+			require.Equal(t, roots.TargetChange{New: digest.FromBytes([]byte(`{}`))}, ev.ChangedTargets["keyring.json"])
+			break
+		}
+	}
+	require.Equal(t, n, closed.Load())
+
+	require.NoError(t, v2.Close())
+}
+
+func TestVerifyImageDHIKeyValidity(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	img := newTestDHIImage(t, key)
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		key     func(*dhi.Key)
+		wantErr error
+	}{
+		"valid": {
+			key: func(k *dhi.Key) {
+				k.NotBefore = now.Add(-time.Hour)
+				k.NotAfter = now.Add(time.Hour)
+			},
+		},
+		"expired": {
+			key: func(k *dhi.Key) {
+				k.NotAfter = now.Add(-time.Hour)
+			},
+			wantErr: dhi.ErrKeyNotValid,
+		},
+		"revoked": {
+			key: func(k *dhi.Key) {
+				k.Revoked = true
+			},
+			wantErr: dhi.ErrKeyRevoked,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k := key.key()
+			tc.key(k)
+			v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, k)})
+			require.NoError(t, err)
+			defer v.Close()
+
+			si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, si.IsDHI)
+			require.False(t, si.TransparencyLog)
+			require.Empty(t, si.Timestamps)
+			require.NotEmpty(t, si.DHIKeyID)
+		})
+	}
+}
+
+func TestVerifierDHIKeyring(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	key1 := newTestDHIKey(t)
+	key2 := newTestDHIKey(t)
+	keyring := func(k *testDHIKey) []byte {
+		dt, err := json.Marshal(dhi.Keyring{Keys: []*dhi.Key{k.key()}})
+		require.NoError(t, err)
+		return dt
+	}
+	tp, repo := newTestTrustProvider(t, roots.SigstoreRootsConfig{UpdateInterval: 10 * time.Millisecond}, map[string][]byte{
+		"keyring.json": keyring(key1),
+	})
+	defer tp.Close()
+
+	img1 := newTestDHIImage(t, key1)
+	img1.attest(slsa1.PredicateSLSAProvenance, img1.statement(slsa1.PredicateSLSAProvenance, img1.manifest.Digest, map[string]any{}))
+	img2 := newTestDHIImage(t, key2)
+	img2.attest(slsa1.PredicateSLSAProvenance, img2.statement(slsa1.PredicateSLSAProvenance, img2.manifest.Digest, map[string]any{}))
+
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringTarget: "keyring.json"})
+	require.NoError(t, err)
+	defer v.Close()
+
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.NoError(t, err)
+	_, err = v.VerifyImage(t.Context(), img2.store, img2.index, &testPlatform)
+	require.Error(t, err)
+
+	// the parsed keyring is kept until the trust root is updated
+	kr1, err := v.dhiKeyring(t.Context(), tp)
+	require.NoError(t, err)
+	kr2, err := v.dhiKeyring(t.Context(), tp)
+	require.NoError(t, err)
+	require.Same(t, kr1, kr2)
+
+	updated := make(chan struct{}, 1)
+	v.SubscribeTrustRoot(func(ev roots.Event) {
+		if _, ok := ev.ChangedTargets["keyring.json"]; ok {
+			select {
+			case updated <- struct{}{}:
+			default:
+			}
+		}
+	})
+	repo.SetTarget("keyring.json", keyring(key2))
+	repo.Publish()
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for keyring update")
+	}
+
+	_, err = v.VerifyImage(t.Context(), img2.store, img2.index, &testPlatform)
+	require.NoError(t, err)
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.Error(t, err)
+	require.NoError(t, v.Close())
+}
+
+func TestVerifierDHIKeyringError(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	for name, cfg := range map[string]Config{
+		"missing-path":   {DHIKeyringPath: filepath.Join(t.TempDir(), "keyring.json")},
+		"invalid-path":   {DHIKeyringPath: writeTestKeyring(t, &dhi.Key{PublicKey: "invalid"})},
+		"missing-target": {DHIKeyringTarget: "keyring.json"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.TrustProvider = tp
+			v, err := NewVerifier(cfg)
+			require.NoError(t, err)
+			defer v.Close()
+
+			// the embedded keyring is not used instead
+			_, err = v.dhiKeyring(t.Context(), tp)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestVerifierDHIKeyringReload(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key1 := newTestDHIKey(t)
+	key2 := newTestDHIKey(t)
+	img1 := newTestDHIImage(t, key1)
+	img1.attest(slsa1.PredicateSLSAProvenance, img1.statement(slsa1.PredicateSLSAProvenance, img1.manifest.Digest, map[string]any{}))
+	img2 := newTestDHIImage(t, key2)
+	img2.attest(slsa1.PredicateSLSAProvenance, img2.statement(slsa1.PredicateSLSAProvenance, img2.manifest.Digest, map[string]any{}))
+
+	p := writeTestKeyring(t, key1.key())
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: p})
+	require.NoError(t, err)
+	defer v.Close()
+
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.NoError(t, err)
+
+	// the file is only read again after a trust root update
+	require.NoError(t, os.WriteFile(p, []byte("invalid"), 0o600))
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.NoError(t, err)
+
+	// a keyring that fails to load keeps the previous one
+	v.notify(roots.Event{Type: roots.EventUpdated})
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.NoError(t, err)
+
+	dt, err := os.ReadFile(writeTestKeyring(t, key2.key()))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p, dt, 0o600))
+	v.notify(roots.Event{Type: roots.EventUpdated})
+	_, err = v.VerifyImage(t.Context(), img2.store, img2.index, &testPlatform)
+	require.NoError(t, err)
+	_, err = v.VerifyImage(t.Context(), img1.store, img1.index, &testPlatform)
+	require.Error(t, err)
+}
+
+func TestVerifyImageStatements(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	provenance := map[string]any{"runDetails": map[string]any{"builder": map[string]any{"id": "https://example.com/builder"}}}
+	sbom := ocispecs.Descriptor{
+		MediaType:   mediaTypeInTotoStatement,
+		Digest:      digest.FromString("unreadable"),
+		Size:        10,
+		Annotations: map[string]string{image.AnnotationInTotoPredicateType: PredicateTypeSPDX},
+	}
+
+	t.Run("statement", func(t *testing.T) {
+		img := newTestDHIImage(t, key)
+		// layers of other predicate types are not read
+		img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, provenance), sbom)
+
+		si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.NoError(t, err)
+		require.NotNil(t, si.Provenance)
+		require.Equal(t, "https://example.com/builder", si.Provenance.BuilderID)
+	})
+
+	t.Run("dsse", func(t *testing.T) {
+		img := newTestDHIImage(t, key)
+		img.attest(slsa1.PredicateSLSAProvenance, img.dsseStatement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, provenance))
+
+		si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.NoError(t, err)
+		require.NotNil(t, si.Provenance)
+		require.Equal(t, "https://example.com/builder", si.Provenance.BuilderID)
+	})
+
+	t.Run("subject-mismatch", func(t *testing.T) {
+		img := newTestDHIImage(t, key)
+		other := digest.FromString("other")
+		att := img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, other, provenance))
+
+		_, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		var serr *SubjectMismatchError
+		require.ErrorAs(t, err, &serr)
+		require.Equal(t, &SubjectMismatchError{
+			Attestation:   att.Digest,
+			PredicateType: slsa1.PredicateSLSAProvenance,
+			Expected:      img.manifest.Digest,
+			Subjects:      []digest.Digest{other},
+		}, serr)
+	})
+
+	t.Run("predicate-type-mismatch", func(t *testing.T) {
+		img := newTestDHIImage(t, key)
+		layer := img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{})
+		layer.Annotations[image.AnnotationInTotoPredicateType] = slsa1.PredicateSLSAProvenance
+		img.attest(slsa1.PredicateSLSAProvenance, layer)
+
+		_, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.ErrorContains(t, err, "does not match annotation")
+	})
+
+	// images built with BuildKit have the attestation manifest in the index
+	// and are signed with a Sigstore bundle
+	sigstore := newTestSigstore(t)
+	bundleTP, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, map[string][]byte{
+		"trusted_root.json": sigstore.trustedRoot(),
+	})
+	defer bundleTP.Close()
+	bv, err := NewVerifier(Config{TrustProvider: bundleTP})
+	require.NoError(t, err)
+	defer bv.Close()
+
+	t.Run("bundle", func(t *testing.T) {
+		img := newTestImage(t, sigstore)
+		img.attest(img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, provenance), sbom)
+
+		si, err := bv.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.NoError(t, err)
+		require.False(t, si.IsDHI)
+		require.Equal(t, types.SignatureBundleV03, si.SignatureType)
+		require.NotNil(t, si.Provenance)
+		require.Equal(t, "https://example.com/builder", si.Provenance.BuilderID)
+	})
+
+	t.Run("bundle-subject-mismatch", func(t *testing.T) {
+		img := newTestImage(t, sigstore)
+		other := digest.FromString("other")
+		att := img.attest(img.statement(slsa1.PredicateSLSAProvenance, other, provenance))
+
+		_, err := bv.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		var serr *SubjectMismatchError
+		require.ErrorAs(t, err, &serr)
+		require.Equal(t, &SubjectMismatchError{
+			Attestation:   att.Digest,
+			PredicateType: slsa1.PredicateSLSAProvenance,
+			Expected:      img.manifest.Digest,
+			Subjects:      []digest.Digest{other},
+		}, serr)
+	})
+
+	t.Run("bundle-layer-tampered", func(t *testing.T) {
+		img := newTestImage(t, sigstore)
+		layer := img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, provenance)
+		img.attest(layer)
+		img.store.replace(layer.Digest, []byte(`{"predicateType":"`+slsa1.PredicateSLSAProvenance+`"}`))
+
+		_, err := bv.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.ErrorContains(t, err, "digest mismatch")
+	})
+}
+
+func TestVerifyImageProvenance(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	for name, tc := range map[string]struct {
+		predicateType string
+		predicate     any
+		wantBuilderID string
+		wantErr       string
+	}{
+		"slsa1": {
+			predicateType: slsa1.PredicateSLSAProvenance,
+			predicate: map[string]any{
+				"buildDefinition": map[string]any{"buildType": "https://example.com/build"},
+				"runDetails":      map[string]any{"builder": map[string]any{"id": "https://example.com/builder"}},
+			},
+			wantBuilderID: "https://example.com/builder",
+		},
+		"slsa02": {
+			predicateType: slsa02.PredicateSLSAProvenance,
+			predicate: map[string]any{
+				"buildType": "https://example.com/build",
+				"builder":   map[string]any{"id": "https://example.com/builder"},
+			},
+			wantBuilderID: "https://example.com/builder",
+		},
+		"invalid": {
+			predicateType: slsa1.PredicateSLSAProvenance,
+			predicate:     map[string]any{"runDetails": "invalid"},
+			wantErr:       "unmarshaling SLSA v1 provenance",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			img := newTestDHIImage(t, key)
+			img.attest(tc.predicateType, img.statement(tc.predicateType, img.manifest.Digest, tc.predicate))
+
+			si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+			require.NoError(t, err)
+			if tc.wantErr != "" {
+				// the signature is still valid
+				require.Nil(t, si.Provenance)
+				require.Contains(t, si.ProvenanceError, tc.wantErr)
+				return
+			}
+			require.Empty(t, si.ProvenanceError)
+			require.NotNil(t, si.Provenance)
+			require.Equal(t, tc.predicateType, si.Provenance.PredicateType)
+			require.Equal(t, tc.wantBuilderID, si.Provenance.BuilderID)
+			require.Equal(t, "https://example.com/build", si.Provenance.BuildType)
+		})
+	}
+
+	t.Run("bundle", func(t *testing.T) {
+		sigstore := newTestSigstore(t)
+		tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, map[string][]byte{
+			"trusted_root.json": sigstore.trustedRoot(),
+		})
+		defer tp.Close()
+		v, err := NewVerifier(Config{TrustProvider: tp})
+		require.NoError(t, err)
+		defer v.Close()
+
+		img := newTestImage(t, sigstore)
+		img.attest(img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{
+			"buildDefinition": map[string]any{"buildType": "https://example.com/build"},
+			"runDetails":      map[string]any{"builder": map[string]any{"id": "https://example.com/builder"}},
+		}))
+		si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.NoError(t, err)
+		require.NotNil(t, si.Provenance)
+		require.Equal(t, "https://example.com/builder", si.Provenance.BuilderID)
+
+		img = newTestImage(t, sigstore)
+		img.attest(img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{"runDetails": "invalid"}))
+		si, err = v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+		require.NoError(t, err)
+		require.NotNil(t, si.Signer)
+		require.Nil(t, si.Provenance)
+		require.Contains(t, si.ProvenanceError, "unmarshaling SLSA v1 provenance")
+	})
+}
+
+func TestVerifyImageRequiredPredicateTypes(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	// DHI images have an attestation manifest for every predicate type
+	const testResults = "https://example.com/test-results/v1"
+	img := newTestDHIImage(t, key)
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+	img.attest(testResults, img.statement(testResults, img.manifest.Digest, map[string]any{"passed": true}))
+	img.attest(PredicateTypeSPDX, img.statement(PredicateTypeSPDX, img.manifest.Digest, map[string]any{"spdxVersion": "SPDX-2.3"}))
+	noSLSA := newTestDHIImage(t, key)
+	noSLSA.attest(testResults, noSLSA.statement(testResults, noSLSA.manifest.Digest, map[string]any{"passed": true}))
+
+	testResultsAtt := types.Attestation{PredicateType: testResults, Predicate: []byte(`{"passed":true}`)}
+	spdxAtt := types.Attestation{PredicateType: PredicateTypeSPDX, Predicate: []byte(`{"spdxVersion":"SPDX-2.3"}`)}
+
+	for name, tc := range map[string]struct {
+		img     *testDHIImage
+		opts    []ImageVerifyOpt
+		want    []types.Attestation
+		wantErr string
+	}{
+		"default": {
+			img: img,
+		},
+		"required": {
+			img:  img,
+			opts: []ImageVerifyOpt{WithRequiredPredicateTypes(testResults)},
+			want: []types.Attestation{testResultsAtt},
+		},
+		"required-multiple": {
+			img:  img,
+			opts: []ImageVerifyOpt{WithRequiredPredicateTypes(PredicateTypeSPDX, testResults)},
+			want: []types.Attestation{spdxAtt, testResultsAtt},
+		},
+		"required-missing": {
+			img:     img,
+			opts:    []ImageVerifyOpt{WithRequiredPredicateTypes(testResults, PredicateTypeCycloneDX)},
+			wantErr: "no signed " + PredicateTypeCycloneDX + " attestation found",
+		},
+		"slsa-required": {
+			img:  img,
+			opts: []ImageVerifyOpt{WithRequiredPredicateTypes(testResults), WithSLSARequired()},
+			want: []types.Attestation{testResultsAtt},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			si, err := v.VerifyImage(t.Context(), tc.img.store, tc.img.index, &testPlatform, tc.opts...)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, si.Attestations)
+		})
+	}
+
+	t.Run("dhi-attestations", func(t *testing.T) {
+		atts, err := v.VerifyDHIAttestations(t.Context(), noSLSA.store, noSLSA.index, &testPlatform, WithRequiredPredicateTypes(testResults))
+		require.NoError(t, err)
+		require.Len(t, atts[testResults], 1)
+
+		_, err = v.VerifyDHIAttestations(t.Context(), noSLSA.store, noSLSA.index, &testPlatform, WithSLSARequired())
+		require.ErrorContains(t, err, "no signed SLSA provenance attestation found")
+	})
+
+	t.Run("image-chain", func(t *testing.T) {
+		_, err := v.VerifyImageChain(t.Context(), img.store, img.index, &testPlatform, WithRequiredPredicateTypes(testResults))
+		require.ErrorContains(t, err, "use VerifyDHIAttestations")
+	})
+}
+
+func TestVerifyImageDHITransparencyLog(t *testing.T) {
+	tp, _ := newTestTrustProvider(t, roots.SigstoreRootsConfig{}, nil)
+	defer tp.Close()
+
+	key := newTestDHIKey(t)
+	v, err := NewVerifier(Config{TrustProvider: tp, DHIKeyringPath: writeTestKeyring(t, key.key())})
+	require.NoError(t, err)
+	defer v.Close()
+
+	img := newTestDHIImage(t, key)
+	img.attest(slsa1.PredicateSLSAProvenance, img.statement(slsa1.PredicateSLSAProvenance, img.manifest.Digest, map[string]any{}))
+
+	si, err := v.VerifyImage(t.Context(), img.store, img.index, &testPlatform)
+	require.NoError(t, err)
+	require.True(t, si.IsDHI)
+	require.False(t, si.TransparencyLog)
+
+	_, err = v.VerifyImage(t.Context(), img.store, img.index, &testPlatform, WithDHITransparencyLogRequired())
+	require.ErrorContains(t, err, "is not transparency logged")
+}